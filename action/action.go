@@ -3,7 +3,9 @@ package action
 import (
 	"errors"
 	"github.com/anaminus/rbxplore/event"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type Action interface {
@@ -20,94 +22,66 @@ type Action interface {
 	Backward() error
 }
 
-// An undo/redo stack with a circular buffer.
-type historyStack struct {
-	buffer          []Action
-	head, tail, cur int
-	ud, rd          bool
+// Describer is implemented by actions that have a human-readable
+// description.
+type Describer interface {
+	// Description briefly describes the action, such as "Set Name".
+	Description() string
 }
 
-func (c *historyStack) Do(a Action) {
-	if c.head == c.tail && c.ud {
-		c.head++
-		if c.head >= len(c.buffer) {
-			c.head = 0
-		}
-	}
-	if c.rd {
-		if c.tail <= c.cur {
-			for i := c.cur; i < len(c.buffer); i++ {
-				c.buffer[i] = nil
-			}
-			for i := 0; i < c.tail; i++ {
-				c.buffer[i] = nil
-			}
-		} else {
-			for i := c.cur; i <= c.tail; i++ {
-				c.buffer[i] = nil
-			}
-		}
-		c.tail = c.cur
-		c.rd = false
-	}
-	c.buffer[c.cur] = a
-	c.ud = true
-	c.cur++
-	if c.cur >= len(c.buffer) {
-		c.cur = 0
-	}
-	c.tail++
-	if c.tail >= len(c.buffer) {
-		c.tail = 0
+// Describe returns the description of an action, if it has one.
+func Describe(a Action) string {
+	if d, ok := a.(Describer); ok {
+		return d.Description()
 	}
+	return "Edit"
 }
 
-func (c *historyStack) Undo() (a Action) {
-	if c.ud {
-		c.cur--
-		if c.cur < 0 {
-			c.cur = len(c.buffer) - 1
-		}
-		a = c.buffer[c.cur]
-		if c.cur == c.head {
-			c.ud = false
-		}
-		c.rd = true
-	}
-	return
+// Labeled gives a description to an action, such as a Group, that would
+// otherwise be described in terms of its parts.
+type Labeled struct {
+	Action
+	Label string
 }
 
-func (c *historyStack) Redo() (a Action) {
-	if c.rd {
-		a = c.buffer[c.cur]
-		c.cur++
-		if c.cur >= len(c.buffer) {
-			c.cur = 0
-		}
-		if c.cur == c.tail {
-			c.rd = false
-		}
-		c.ud = true
-	}
-	return
+func (a Labeled) Description() string {
+	return a.Label
 }
 
+// Position identifies a state in the history of a Controller. Each action
+// done by the controller produces a new position, which is never reused.
+type Position uint64
+
+// NoPosition is a Position that does not correspond to any state.
+const NoPosition = ^Position(0)
+
 var NoAction = errors.New("no action")
 
 type Controller struct {
 	sync.Mutex
-	stack    *historyStack
+	history  *historyTree
+	next     Position
 	onUpdate event.Event
 }
 
 func CreateController(historySize int) *Controller {
 	return &Controller{
-		stack: &historyStack{
-			buffer: make([]Action, historySize),
-		},
+		history:  newHistoryTree(historySize, 0),
+		next:     1,
+		onUpdate: event.New(true),
 	}
 }
 
+// Position returns the position of the current state. Two positions are
+// equal only if the state has not been changed between them, or has been
+// returned to by undoing or redoing. A state that is no longer reachable
+// because its actions were evicted from the history is never returned to.
+//
+// The controller must be locked if actions may be done concurrently.
+func (ac *Controller) Position() Position {
+	return ac.history.Position()
+}
+
 func (ac *Controller) OnUpdate(listener func(...interface{})) event.Connection {
 	if ac.onUpdate == nil {
 		ac.onUpdate = event.New(true)
@@ -115,6 +89,120 @@ func (ac *Controller) OnUpdate(listener func(...interface{})) event.Connection {
 	return ac.onUpdate.Connect(listener)
 }
 
+// UndoAction returns the action that would be reversed by Undo, or nil if
+// there is no such action.
+//
+// The controller must be locked if actions may be done concurrently.
+func (ac *Controller) UndoAction() Action {
+	return ac.history.cur.action
+}
+
+// RedoAction returns the action that would be performed by Redo, or nil if
+// there is no such action.
+//
+// The controller must be locked if actions may be done concurrently.
+func (ac *Controller) RedoAction() Action {
+	if ac.history.cur.redo == nil {
+		return nil
+	}
+	return ac.history.cur.redo.action
+}
+
+// Node describes a state in the history of a Controller.
+type Node struct {
+	// Position is the position of the state.
+	Position Position
+	// Parent is the index of the state that Action was done to, or -1 for
+	// the oldest state.
+	Parent int
+	// Action is the action that resulted in the state. Nil for the oldest
+	// state.
+	Action Action
+	// Time is when the action was done.
+	Time time.Time
+	// Redo is the index of the state that is returned to when redoing from
+	// this state, or -1 if there is no such state.
+	Redo int
+}
+
+// History returns each state in the history, in the order they were
+// created, starting with the oldest state. Doing an action after undoing
+// creates a new branch, so the history forms a tree. current is the index of
+// the current state.
+//
+// The controller must be locked if actions may be done concurrently.
+func (ac *Controller) History() (nodes []Node, current int) {
+	list := ac.history.Nodes()
+	index := make(map[*historyNode]int, len(list))
+	nodes = make([]Node, len(list))
+	for i, n := range list {
+		index[n] = i
+		nodes[i] = Node{Position: n.id, Parent: -1, Action: n.action, Time: n.time, Redo: -1}
+		if n.parent != nil {
+			nodes[i].Parent = index[n.parent]
+		}
+		if n == ac.history.cur {
+			current = i
+		}
+	}
+	for i, n := range list {
+		if n.redo != nil {
+			nodes[i].Redo = index[n.redo]
+		}
+	}
+	return nodes, current
+}
+
+// SetHistory replaces the history with the given states, as returned by
+// History. The Position of each node is ignored; new positions are assigned
+// instead. The actions must already be set up, and the current state must be
+// the state at index current. No actions are performed. A state whose Redo
+// does not refer to one of its children redoes its newest child.
+//
+// If there are more actions than the history can hold, the oldest are
+// evicted.
+func (ac *Controller) SetHistory(nodes []Node, current int) {
+	ac.Lock()
+	defer ac.Unlock()
+
+	ac.history = newHistoryTree(ac.history.size, ac.next)
+	ac.next++
+	if len(nodes) > 0 {
+		ac.history.root.time = nodes[0].Time
+	}
+	list := make([]*historyNode, len(nodes))
+	if len(list) > 0 {
+		list[0] = ac.history.root
+	}
+	for i := 1; i < len(nodes); i++ {
+		parent := list[0]
+		if p := nodes[i].Parent; p >= 0 && p < i {
+			parent = list[p]
+		}
+		n := &historyNode{
+			parent: parent,
+			action: nodes[i].Action,
+			id:     ac.next,
+			time:   nodes[i].Time,
+		}
+		ac.next++
+		parent.children = append(parent.children, n)
+		parent.redo = n
+		list[i] = n
+		ac.history.count++
+	}
+	for i, node := range nodes {
+		if r := node.Redo; r > i && r < len(list) && list[r].parent == list[i] {
+			list[i].redo = list[r]
+		}
+	}
+	if current >= 0 && current < len(list) {
+		ac.history.cur = list[current]
+	}
+	ac.history.evict()
+	ac.onUpdate.Fire()
+}
+
 func (ac *Controller) Do(a Action) error {
 	ac.Lock()
 	defer ac.Unlock()
@@ -126,9 +214,30 @@ func (ac *Controller) Do(a Action) error {
 		return err
 	}
 	if err := a.Forward(); err != nil {
+		if partial(err) {
+			ac.damaged()
+		}
 		return err
 	}
-	ac.stack.Do(a)
+	ac.history.Do(a, ac.next)
+	ac.next++
+	ac.onUpdate.Fire()
+	return nil
+}
+
+// Record adds an action to the history as if it were done by Do, without
+// performing it. The action must already be set up and performed. This
+// allows a series of actions that depend on each other's results to be
+// undone as one.
+func (ac *Controller) Record(a Action) error {
+	ac.Lock()
+	defer ac.Unlock()
+
+	if a == nil {
+		return NoAction
+	}
+	ac.history.Do(a, ac.next)
+	ac.next++
 	ac.onUpdate.Fire()
 	return nil
 }
@@ -137,53 +246,178 @@ func (ac *Controller) Undo() error {
 	ac.Lock()
 	defer ac.Unlock()
 
-	a := ac.stack.Undo()
+	a := ac.history.Undo()
 	if a == nil {
 		return NoAction
 	}
-	err := a.Backward()
+	if err := a.Backward(); err != nil {
+		if partial(err) {
+			ac.damaged()
+		} else {
+			ac.history.Redo()
+		}
+		return err
+	}
 	ac.onUpdate.Fire()
-	return err
+	return nil
 }
 
 func (ac *Controller) Redo() error {
 	ac.Lock()
 	defer ac.Unlock()
 
-	a := ac.stack.Redo()
+	a := ac.history.Redo()
 	if a == nil {
 		return NoAction
 	}
-	err := a.Forward()
+	if err := a.Forward(); err != nil {
+		if partial(err) {
+			ac.damaged()
+		} else {
+			ac.history.Undo()
+		}
+		return err
+	}
+	ac.onUpdate.Fire()
+	return nil
+}
+
+// partial returns whether err indicates that an action was partially
+// performed.
+func partial(err error) bool {
+	gerr, ok := err.(*GroupError)
+	return ok && gerr.Rollback != nil
+}
+
+// damaged discards the history after an action was partially performed. The
+// resulting state does not correspond to any state in the history, and
+// cannot be reliably undone, so it is given a new position with no actions
+// before it.
+func (ac *Controller) damaged() {
+	ac.history = newHistoryTree(ac.history.size, ac.next)
+	ac.next++
+	ac.onUpdate.Fire()
+}
+
+// Goto undoes and redoes actions until the state at the given position is
+// reached. The state may be on a different branch than the current state.
+func (ac *Controller) Goto(p Position) error {
+	ac.Lock()
+	defer ac.Unlock()
+
+	node := ac.history.Find(p)
+	if node == nil {
+		return errors.New("position not in history")
+	}
+	undo, redo := ac.history.Path(node)
+	if len(undo) == 0 && len(redo) == 0 {
+		return nil
+	}
+	for range undo {
+		if err := ac.history.Undo().Backward(); err != nil {
+			if partial(err) {
+				ac.damaged()
+				return err
+			}
+			ac.history.Redo()
+			ac.onUpdate.Fire()
+			return err
+		}
+	}
+	for _, n := range redo {
+		n.parent.redo = n
+		if err := ac.history.Redo().Forward(); err != nil {
+			if partial(err) {
+				ac.damaged()
+				return err
+			}
+			ac.history.Undo()
+			ac.onUpdate.Fire()
+			return err
+		}
+	}
 	ac.onUpdate.Fire()
-	return err
+	return nil
 }
 
 type Group []Action
 
+func (a Group) Description() string {
+	switch len(a) {
+	case 0:
+		return "Nothing"
+	case 1:
+		return Describe(a[0])
+	}
+	return Describe(a[0]) + " and " + strconv.Itoa(len(a)-1) + " more"
+}
+
 func (a Group) Setup() error {
-	for _, action := range a {
+	for i, action := range a {
 		if err := action.Setup(); err != nil {
-			return err
+			return &GroupError{Op: "setup", Index: i, Action: action, Err: err}
 		}
 	}
 	return nil
 }
 
+// Forward performs each action in order. If an action fails, the actions
+// that were already performed are reversed, and a GroupError is returned.
 func (a Group) Forward() error {
-	for _, action := range a {
+	for i, action := range a {
 		if err := action.Forward(); err != nil {
-			return err
+			gerr := &GroupError{Op: "do", Index: i, Action: action, Err: err}
+			for j := i - 1; j >= 0; j-- {
+				if err := a[j].Backward(); err != nil {
+					gerr.Rollback = err
+					break
+				}
+			}
+			return gerr
 		}
 	}
 	return nil
 }
 
+// Backward reverses each action in reverse order. If an action fails, the
+// actions that were already reversed are performed again, and a GroupError
+// is returned.
 func (a Group) Backward() error {
-	for i := range a {
-		if err := a[len(a)-1-i].Backward(); err != nil {
-			return err
+	for i := len(a) - 1; i >= 0; i-- {
+		if err := a[i].Backward(); err != nil {
+			gerr := &GroupError{Op: "undo", Index: i, Action: a[i], Err: err}
+			for j := i + 1; j < len(a); j++ {
+				if err := a[j].Forward(); err != nil {
+					gerr.Rollback = err
+					break
+				}
+			}
+			return gerr
 		}
 	}
 	return nil
 }
+
+// GroupError is returned by a Group when one of its actions fails. Unless
+// Rollback is set, the group has no effect.
+type GroupError struct {
+	// Op is the operation that failed; "setup", "do", or "undo".
+	Op string
+	// Index is the index of the failing action within the group.
+	Index int
+	// Action is the failing action.
+	Action Action
+	// Err is the error returned by the action.
+	Err error
+	// Rollback is the error that occurred while reversing the actions that
+	// had already succeeded. If set, the group was partially applied.
+	Rollback error
+}
+
+func (err *GroupError) Error() string {
+	s := "could not " + err.Op + " step " + strconv.Itoa(err.Index+1) + " (" + Describe(err.Action) + "): " + err.Err.Error()
+	if err.Rollback != nil {
+		s += "; changes could not be reversed: " + err.Rollback.Error()
+	}
+	return s
+}
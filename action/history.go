@@ -0,0 +1,177 @@
+package action
+
+import (
+	"sort"
+	"time"
+)
+
+// historyNode is a state in a historyTree. Each node other than the root is
+// the result of doing its action to the state of its parent.
+type historyNode struct {
+	parent   *historyNode
+	children []*historyNode
+	action   Action
+	id       Position
+	time     time.Time
+	// redo is the child that is returned to when redoing. This is the child
+	// that was most recently undone, or most recently created.
+	redo *historyNode
+}
+
+// An undo tree. Doing an action after undoing creates a new branch, leaving
+// the undone actions in place.
+type historyTree struct {
+	root, cur *historyNode
+	// size is the maximum number of actions in the tree.
+	size  int
+	count int
+}
+
+func newHistoryTree(size int, base Position) *historyTree {
+	root := &historyNode{id: base, time: time.Now()}
+	return &historyTree{root: root, cur: root, size: size}
+}
+
+func (t *historyTree) Position() Position {
+	return t.cur.id
+}
+
+func (t *historyTree) Do(a Action, id Position) {
+	node := &historyNode{parent: t.cur, action: a, id: id, time: time.Now()}
+	t.cur.children = append(t.cur.children, node)
+	t.cur.redo = node
+	t.cur = node
+	t.count++
+	t.evict()
+}
+
+func (t *historyTree) Undo() (a Action) {
+	if t.cur.parent == nil {
+		return nil
+	}
+	a = t.cur.action
+	t.cur.parent.redo = t.cur
+	t.cur = t.cur.parent
+	return a
+}
+
+func (t *historyTree) Redo() (a Action) {
+	if t.cur.redo == nil {
+		return nil
+	}
+	t.cur = t.cur.redo
+	return t.cur.action
+}
+
+// Path returns the nodes that must be undone, and the nodes that must be
+// redone, in order, to go from the current node to node.
+func (t *historyTree) Path(node *historyNode) (undo, redo []*historyNode) {
+	depth := func(n *historyNode) (d int) {
+		for ; n.parent != nil; n = n.parent {
+			d++
+		}
+		return d
+	}
+	a, b := t.cur, node
+	da, db := depth(a), depth(b)
+	for ; da > db; da-- {
+		undo = append(undo, a)
+		a = a.parent
+	}
+	for ; db > da; db-- {
+		redo = append(redo, b)
+		b = b.parent
+	}
+	for a != b {
+		undo = append(undo, a)
+		redo = append(redo, b)
+		a, b = a.parent, b.parent
+	}
+	for i, j := 0, len(redo)-1; i < j; i, j = i+1, j-1 {
+		redo[i], redo[j] = redo[j], redo[i]
+	}
+	return undo, redo
+}
+
+// Find returns the node with the given position, or nil if there is no such
+// node.
+func (t *historyTree) Find(id Position) *historyNode {
+	var found *historyNode
+	t.walk(func(n *historyNode) {
+		if n.id == id {
+			found = n
+		}
+	})
+	return found
+}
+
+// Nodes returns each node in the order they were created, starting with the
+// root.
+func (t *historyTree) Nodes() []*historyNode {
+	nodes := make([]*historyNode, 0, t.count+1)
+	t.walk(func(n *historyNode) {
+		nodes = append(nodes, n)
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].id < nodes[j].id
+	})
+	return nodes
+}
+
+func (t *historyTree) walk(fn func(n *historyNode)) {
+	var walk func(n *historyNode)
+	walk = func(n *historyNode) {
+		fn(n)
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(t.root)
+}
+
+// evict removes the oldest nodes until the tree is within its size. A leaf
+// that is not an ancestor of the current node is removed by discarding its
+// branch. Otherwise, the root is removed, so that the state before the
+// oldest action can no longer be reached.
+func (t *historyTree) evict() {
+	for t.count > t.size {
+		current := map[*historyNode]bool{}
+		for n := t.cur; n != nil; n = n.parent {
+			current[n] = true
+		}
+		var oldest *historyNode
+		t.walk(func(n *historyNode) {
+			if len(n.children) == 0 && !current[n] && (oldest == nil || n.id < oldest.id) {
+				oldest = n
+			}
+		})
+		if len(t.root.children) == 1 && t.root != t.cur {
+			if child := t.root.children[0]; oldest == nil || child.id < oldest.id {
+				child.parent = nil
+				child.action = nil
+				t.root = child
+				t.count--
+				continue
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		parent := oldest.parent
+		for i, child := range parent.children {
+			if child == oldest {
+				copy(parent.children[i:], parent.children[i+1:])
+				parent.children[len(parent.children)-1] = nil
+				parent.children = parent.children[:len(parent.children)-1]
+				break
+			}
+		}
+		if parent.redo == oldest {
+			parent.redo = nil
+			if n := len(parent.children); n > 0 {
+				parent.redo = parent.children[n-1]
+			}
+		}
+		t.count--
+	}
+}
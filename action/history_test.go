@@ -0,0 +1,218 @@
+package action
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// push is an action that appends a name to a list, which represents the
+// state of a tree.
+type push struct {
+	state *[]string
+	name  string
+}
+
+func (a *push) Setup() error {
+	return nil
+}
+
+func (a *push) Forward() error {
+	*a.state = append(*a.state, a.name)
+	return nil
+}
+
+func (a *push) Backward() error {
+	s := *a.state
+	if len(s) == 0 || s[len(s)-1] != a.name {
+		return errors.New("cannot undo " + a.name + " from " + strings.Join(s, ","))
+	}
+	*a.state = s[:len(s)-1]
+	return nil
+}
+
+type historyTest struct {
+	t     *testing.T
+	ac    *Controller
+	state []string
+}
+
+func newHistoryTest(t *testing.T, size int) *historyTest {
+	return &historyTest{t: t, ac: CreateController(size)}
+}
+
+func (h *historyTest) do(names ...string) {
+	for _, name := range names {
+		if err := h.ac.Do(&push{state: &h.state, name: name}); err != nil {
+			h.t.Fatalf("do %s: %s", name, err)
+		}
+	}
+}
+
+func (h *historyTest) undo(n int) {
+	for i := 0; i < n; i++ {
+		if err := h.ac.Undo(); err != nil {
+			h.t.Fatalf("undo: %s", err)
+		}
+	}
+}
+
+func (h *historyTest) redo(n int) {
+	for i := 0; i < n; i++ {
+		if err := h.ac.Redo(); err != nil {
+			h.t.Fatalf("redo: %s", err)
+		}
+	}
+}
+
+func (h *historyTest) expect(want string) {
+	h.t.Helper()
+	if got := strings.Join(h.state, ","); got != want {
+		h.t.Errorf("got state %q, want %q", got, want)
+	}
+}
+
+func TestUndoThenDo(t *testing.T) {
+	h := newHistoryTest(t, 100)
+	h.do("a", "b", "c", "d", "e")
+	h.undo(3)
+	h.expect("a,b")
+	h.do("x")
+	h.expect("a,b,x")
+	if err := h.ac.Redo(); err != NoAction {
+		t.Errorf("redo after doing: got %v, want NoAction", err)
+	}
+
+	// The undone actions are kept as a branch.
+	nodes, current := h.ac.History()
+	if len(nodes) != 7 {
+		t.Fatalf("got %d states, want 7", len(nodes))
+	}
+	if nodes[current].Parent != 2 {
+		t.Errorf("new branch starts from state %d, want 2", nodes[current].Parent)
+	}
+}
+
+func TestRedoKeptBranch(t *testing.T) {
+	h := newHistoryTest(t, 100)
+	h.do("a", "b", "c")
+	h.undo(2)
+	h.do("x")
+	nodes, _ := h.ac.History()
+	c := nodes[3].Position
+
+	// Redo follows the most recently created branch.
+	h.undo(1)
+	h.redo(1)
+	h.expect("a,x")
+
+	// After returning to the old branch, redo follows it instead.
+	if err := h.ac.Goto(c); err != nil {
+		t.Fatal(err)
+	}
+	h.expect("a,b,c")
+	h.undo(2)
+	h.expect("a")
+	h.redo(2)
+	h.expect("a,b,c")
+}
+
+func TestEvictSideBranch(t *testing.T) {
+	// A side branch that is older than the current branch is evicted
+	// first.
+	h := newHistoryTest(t, 3)
+	h.do("a")
+	h.undo(1)
+	h.do("x", "y", "z")
+	nodes, _ := h.ac.History()
+	if len(nodes) != 4 {
+		t.Fatalf("got %d states, want 4", len(nodes))
+	}
+	for _, n := range nodes {
+		if p, ok := n.Action.(*push); ok && p.name == "a" {
+			t.Errorf("abandoned action was kept")
+		}
+	}
+	h.undo(3)
+	h.expect("")
+	if err := h.ac.Undo(); err != NoAction {
+		t.Errorf("undo past oldest state: got %v, want NoAction", err)
+	}
+
+	// While on a side branch, the oldest action shared by both branches is
+	// evicted, leaving both branches reachable.
+	h = newHistoryTest(t, 4)
+	h.do("a", "b", "c")
+	nodes, _ = h.ac.History()
+	c := nodes[3].Position
+	h.undo(2)
+	h.do("x", "y")
+	nodes, _ = h.ac.History()
+	if len(nodes) != 5 {
+		t.Fatalf("got %d states, want 5", len(nodes))
+	}
+	h.undo(2)
+	h.expect("a")
+	if err := h.ac.Undo(); err != NoAction {
+		t.Errorf("undo evicted action: got %v, want NoAction", err)
+	}
+	if err := h.ac.Goto(c); err != nil {
+		t.Fatal(err)
+	}
+	h.expect("a,b,c")
+}
+
+func TestGotoAcrossBranches(t *testing.T) {
+	h := newHistoryTest(t, 100)
+	h.do("a", "b", "c")
+	h.undo(2)
+	h.do("x", "y")
+	h.undo(1)
+	h.do("z")
+
+	nodes, _ := h.ac.History()
+	for i, n := range nodes {
+		var names []string
+		for j := i; nodes[j].Action != nil; j = nodes[j].Parent {
+			names = append([]string{nodes[j].Action.(*push).name}, names...)
+		}
+		if err := h.ac.Goto(n.Position); err != nil {
+			t.Fatalf("goto %d: %s", i, err)
+		}
+		h.expect(strings.Join(names, ","))
+		if h.ac.Position() != n.Position {
+			t.Errorf("goto %d: position not reached", i)
+		}
+	}
+	if err := h.ac.Goto(NoPosition); err == nil {
+		t.Errorf("goto unknown position succeeded")
+	}
+}
+
+func TestSetHistoryKeepsRedo(t *testing.T) {
+	h := newHistoryTest(t, 100)
+	h.do("a", "b")
+	nodes, _ := h.ac.History()
+	b := nodes[2].Position
+	h.undo(1)
+	h.do("x")
+	h.undo(1)
+
+	// Returning to b makes it the state that is redone, even though x is
+	// newer.
+	if err := h.ac.Goto(b); err != nil {
+		t.Fatal(err)
+	}
+	h.undo(1)
+	h.expect("a")
+	if got := h.ac.RedoAction().(*push).name; got != "b" {
+		t.Fatalf("got redo %s, want b", got)
+	}
+
+	nodes, current := h.ac.History()
+	restored := CreateController(100)
+	restored.SetHistory(nodes, current)
+	if got := restored.RedoAction().(*push).name; got != "b" {
+		t.Errorf("got redo %s after restoring, want b", got)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// backupTimeFormat is the layout of the timestamp included in the names of
+// backup files. It sorts lexically in chronological order.
+const backupTimeFormat = "20060102-150405.000000"
+
+// oldBackupTimeFormat is the layout of timestamps that did not include
+// fractional seconds. Such backups are still rotated.
+const oldBackupTimeFormat = "20060102-150405"
+
+// backupName returns the name of a backup of file made at time t. If a
+// backup already exists with that name, a later time is used.
+func backupName(file string, t time.Time) string {
+	for {
+		name := file + "." + t.Format(backupTimeFormat) + ".bak"
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name
+		}
+		t = t.Add(time.Microsecond)
+	}
+}
+
+// listBackups returns the backups of file, ordered from oldest to newest.
+func listBackups(file string) ([]string, error) {
+	file = filepath.Clean(file)
+	matches, err := filepath.Glob(escapeGlob(file) + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	backups := matches[:0]
+	for _, match := range matches {
+		stamp := match[len(file)+1 : len(match)-len(".bak")]
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		} else if _, err := time.Parse(oldBackupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// escapeGlob escapes the metacharacters of a file name so that it can be
+// used literally within a pattern passed to filepath.Glob.
+func escapeGlob(file string) string {
+	b := make([]byte, 0, len(file))
+	for i := 0; i < len(file); i++ {
+		switch c := file[i]; c {
+		case '*', '?', '[':
+			b = append(b, '[', c, ']')
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+// rotateBackups removes the oldest backups of file, such that no more than n
+// backups remain.
+func rotateBackups(file string, n int) error {
+	backups, err := listBackups(file)
+	if err != nil {
+		return err
+	}
+	for len(backups) > n {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// createTemp creates a new file in dir, with a name beginning with prefix.
+// Unlike ioutil.TempFile, the file is created with the same permissions as
+// os.Create, so that a new file is subject only to the umask.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; i < 10000; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, err
+	}
+	return nil, errors.New("could not create temporary file in " + dir)
+}
+
+// copyBackup makes backup a copy of file, linking to it when possible.
+func copyBackup(file, backup string, perm os.FileMode) (err error) {
+	if os.Link(file, backup) == nil {
+		return nil
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(backup, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backup)
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		os.Remove(backup)
+	}
+	return err
+}
+
+// writeFileAtomic calls write with a temporary file located next to file,
+// then replaces file with the temporary file in a single rename. If anything
+// fails, file is left untouched. If file is a symbolic link, the file it
+// points to is replaced instead, so the link is kept.
+//
+// If backups is greater than 0, then the previous content of file is kept as
+// a timestamped backup, and only the most recent backups are retained.
+func writeFileAtomic(file string, backups int, write func(w io.Writer) error) (err error) {
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		file = target
+	}
+	dir, base := filepath.Split(file)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := createTemp(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// Retain the permissions of the file being replaced.
+	stat, statErr := os.Stat(file)
+	if statErr == nil {
+		if err = os.Chmod(tmp.Name(), stat.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	var backup string
+	if backups > 0 && statErr == nil {
+		backup = backupName(file, time.Now())
+		if err = copyBackup(file, backup, stat.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		if backup != "" {
+			os.Remove(backup)
+		}
+		return err
+	}
+	if backups > 0 {
+		// The file was saved successfully, so failing to remove old backups
+		// is not considered an error.
+		if err := rotateBackups(file, backups); err != nil {
+			log.Printf("failed to rotate backups of `%s`: %s\n", file, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anaminus/rbxplore/format"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// batchItem is a single conversion performed in batch mode.
+type batchItem struct {
+	Input  string
+	Output string
+	Err    error
+}
+
+// isGlob returns whether a path contains any pattern metacharacters.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// isBatch returns whether the given inputs must be converted in batch mode.
+// This is the case for multiple inputs, directories, and patterns.
+func isBatch(inputs []string) bool {
+	if len(inputs) > 1 {
+		return true
+	}
+	if len(inputs) == 0 || inputs[0] == StdStream {
+		return false
+	}
+	stat, err := os.Stat(inputs[0])
+	if err != nil {
+		return isGlob(inputs[0])
+	}
+	return stat.IsDir()
+}
+
+// globBase returns the leading directories of a pattern that contain no
+// metacharacters.
+func globBase(pattern string) string {
+	base := pattern
+	for isGlob(base) {
+		base = filepath.Dir(base)
+	}
+	return base
+}
+
+// expandInputs returns the files matched by each input, paired with the
+// location of each file relative to the input. For a pattern, this is
+// relative to the directories before the first metacharacter. Directories are
+// walked recursively, including only files with a known format extension.
+func expandInputs(inputs []string) (files [][2]string, err error) {
+	for _, input := range inputs {
+		var matches []string
+		base := ""
+		if _, err := os.Stat(input); err != nil && isGlob(input) {
+			base = globBase(input)
+			if matches, err = filepath.Glob(input); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match `%s`", input)
+			}
+		} else {
+			matches = []string{input}
+		}
+		for _, match := range matches {
+			stat, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			root := base
+			if root == "" {
+				root = match
+				if !stat.IsDir() {
+					root = filepath.Dir(match)
+				}
+			}
+			if !stat.IsDir() {
+				rel, err := filepath.Rel(root, match)
+				if err != nil {
+					return nil, err
+				}
+				files = append(files, [2]string{match, rel})
+				continue
+			}
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() || format.FromExt(path) == format.None {
+					return nil
+				}
+				rel, err := filepath.Rel(root, path)
+				if err != nil {
+					return err
+				}
+				files = append(files, [2]string{path, rel})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// convertFile converts a single file to the output, using the format of the
+// input when f is None. Content that cannot be represented by the output
+// format is handled according to strategy.
+func convertFile(input, output string, f format.Format, minified bool, strategy format.Strategy) error {
+	session, err := NewSession(input)
+	if err != nil {
+		return fmt.Errorf("decode: %s", err)
+	}
+	if f != format.None {
+		session.Format = f
+		session.Minified = minified
+	}
+	if err := format.Adapt(session.Format, session.Root, Data.API, strategy); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+	session.File = output
+	if err := session.EncodeFile(); err != nil {
+		return fmt.Errorf("encode: %s", err)
+	}
+	return nil
+}
+
+// batchConvert converts each of the inputs into the output directory,
+// mirroring the structure of input directories. Conversions are run in
+// parallel by up to jobs workers. A summary is printed, and the number of
+// failed conversions is returned.
+func batchConvert(inputs []string, outputDir string, f format.Format, minified bool, strategy format.Strategy, jobs int) (failed int) {
+	files, err := expandInputs(inputs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	items := make([]batchItem, len(files))
+	outputs := make(map[string]string, len(files))
+	for i, file := range files {
+		output := filepath.Join(outputDir, file[1])
+		if f != format.None {
+			output = strings.TrimSuffix(output, filepath.Ext(output)) + "." + f.String()
+		}
+		if input, ok := outputs[output]; ok {
+			fmt.Fprintf(os.Stderr, "`%s` and `%s` would both be converted to `%s`\n", input, file[0], output)
+			return 1
+		}
+		outputs[output] = file[0]
+		items[i] = batchItem{Input: file[0], Output: output}
+	}
+
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+	queue := make(chan *batchItem)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				item.Err = convertFile(item.Input, item.Output, f, minified, strategy)
+			}
+		}()
+	}
+	for i := range items {
+		queue <- &items[i]
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, item := range items {
+		if item.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stdout, "FAIL %s: %s\n", item.Input, item.Err)
+		} else {
+			fmt.Fprintf(os.Stdout, "ok   %s -> %s\n", item.Input, item.Output)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "%d converted, %d failed\n", len(items)-failed, failed)
+	return failed
+}
@@ -13,3 +13,55 @@ func CreateButton(theme gxui.Theme, text string) gxui.Button {
 	button.SetText(text)
 	return button
 }
+
+// LabelButton is a button that can be disabled. A disabled button is dimmed,
+// and does not call its click handlers.
+type LabelButton struct {
+	gxui.Button
+	label   gxui.Label
+	enabled bool
+}
+
+func CreateLabelButton(theme gxui.Theme, text string) *LabelButton {
+	b := &LabelButton{
+		Button:  theme.CreateButton(),
+		label:   theme.CreateLabel(),
+		enabled: true,
+	}
+	b.Button.SetDesiredSize(ButtonSize)
+	b.Button.AddChild(b.label)
+	b.label.SetText(text)
+	return b
+}
+
+func (b *LabelButton) Text() string {
+	return b.label.Text()
+}
+
+func (b *LabelButton) SetText(text string) {
+	b.label.SetText(text)
+}
+
+// OnClick adds a handler that is called when the button is clicked while
+// enabled.
+func (b *LabelButton) OnClick(f func(gxui.MouseEvent)) gxui.EventSubscription {
+	return b.Button.OnClick(func(e gxui.MouseEvent) {
+		if b.enabled {
+			f(e)
+		}
+	})
+}
+
+func (b *LabelButton) Enabled() bool {
+	return b.enabled
+}
+
+func (b *LabelButton) SetEnabled(enabled bool) {
+	b.enabled = enabled
+	cl := b.label.Color()
+	if enabled {
+		b.label.SetColor(gxui.Color{cl.R, cl.G, cl.B, 1})
+	} else {
+		b.label.SetColor(gxui.Color{cl.R, cl.G, cl.B, 0.3})
+	}
+}
@@ -21,6 +21,10 @@ func (a *actionAddRoot) Setup() error {
 	return nil
 }
 
+func (a *actionAddRoot) Description() string {
+	return "Add " + a.instance.Name()
+}
+
 func (a *actionAddRoot) Forward() error {
 	a.root.Instances = append(a.root.Instances, a.instance)
 	return nil
@@ -52,6 +56,10 @@ func (a *actionRemoveRoot) Setup() error {
 	return nil
 }
 
+func (a *actionRemoveRoot) Description() string {
+	return "Remove " + a.instance.Name()
+}
+
 func (a *actionRemoveRoot) Forward() error {
 	copy(a.root.Instances[a.index:], a.root.Instances[a.index+1:])
 	a.root.Instances[len(a.root.Instances)-1] = nil
@@ -83,6 +91,10 @@ func (a *actionSetClassName) Setup() error {
 	return nil
 }
 
+func (a *actionSetClassName) Description() string {
+	return "Set ClassName on " + a.instance.Name()
+}
+
 func (a *actionSetClassName) Forward() error {
 	a.instance.ClassName = a.newClassName
 	return nil
@@ -95,10 +107,8 @@ func (a *actionSetClassName) Backward() error {
 
 ////////////////
 
-func SetReference(inst *rbxfile.Instance, ref []byte) action.Action {
-	c := make([]byte, len(ref))
-	copy(c, ref)
-	return &actionSetReference{instance: inst, newRef: c}
+func SetReference(inst *rbxfile.Instance, ref string) action.Action {
+	return &actionSetReference{instance: inst, newRef: ref}
 }
 
 type actionSetReference struct {
@@ -112,6 +122,10 @@ func (a *actionSetReference) Setup() error {
 	return nil
 }
 
+func (a *actionSetReference) Description() string {
+	return "Set Referent on " + a.instance.Name()
+}
+
 func (a *actionSetReference) Forward() error {
 	a.instance.Reference = a.newRef
 	return nil
@@ -149,6 +163,16 @@ func (a *actionSetParent) Setup() error {
 	return nil
 }
 
+func (a *actionSetParent) Description() string {
+	switch {
+	case a.newParent == nil:
+		return "Remove " + a.instance.Name()
+	case a.oldParent == nil:
+		return "Add " + a.instance.Name()
+	}
+	return "Move " + a.instance.Name()
+}
+
 func (a *actionSetParent) Forward() error {
 	return a.instance.SetParent(a.newParent)
 }
@@ -178,6 +202,10 @@ func (a *actionSetIsService) Setup() error {
 	return nil
 }
 
+func (a *actionSetIsService) Description() string {
+	return "Set IsService on " + a.instance.Name()
+}
+
 func (a *actionSetIsService) Forward() error {
 	a.instance.IsService = a.newIsService
 	return nil
@@ -208,6 +236,10 @@ func (a *actionSetProperty) Setup() error {
 	return nil
 }
 
+func (a *actionSetProperty) Description() string {
+	return "Set " + a.prop + " on " + a.instance.Name()
+}
+
 func (a *actionSetProperty) Forward() error {
 	a.instance.Properties[a.prop] = a.newValue
 	return nil
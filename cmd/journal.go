@@ -0,0 +1,563 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/anaminus/rbxplore/action"
+	"github.com/robloxapi/rbxfile"
+	"reflect"
+	"time"
+)
+
+// Journal is a serializable form of the history of a Controller. Instances are
+// identified by their location within the tree at the time the journal was
+// encoded. Instances outside of the tree at that time, such as removed
+// instances, are stored within the journal.
+type Journal struct {
+	// Current is the index of the current state in Nodes.
+	Current int `json:"current"`
+	// Instances contains each instance referred to by the journal. An
+	// instance is referred to by its index plus one, with 0 referring to no
+	// instance.
+	Instances []journalInstance `json:"instances"`
+	// Detached contains the trees of instances that were not under the root.
+	Detached []*journalTree `json:"detached,omitempty"`
+	// Nodes contains each state in the history, from oldest to newest.
+	Nodes []*journalNode `json:"nodes"`
+}
+
+// journalNode is a state in the history.
+type journalNode struct {
+	// Parent is the index of the state that Action was done to, or -1 for
+	// the oldest state.
+	Parent int `json:"parent"`
+	// Time is when the action was done.
+	Time time.Time `json:"time"`
+	// Redo is the index of the state that is returned to when redoing from
+	// this state, or -1 if there is no such state. A missing value refers to
+	// the newest child.
+	Redo int `json:"redo,omitempty"`
+	// Action is nil for the oldest state.
+	Action *journalAction `json:"action,omitempty"`
+}
+
+// journalInstance locates an instance.
+type journalInstance struct {
+	// Tree is the number of the tree in Detached containing the instance,
+	// plus one. 0 refers to the root.
+	Tree int `json:"tree,omitempty"`
+	// Path is the index of each ancestor and the instance within the
+	// children of its parent, starting from the tree.
+	Path []int `json:"path"`
+}
+
+// journalTree is the content of an instance that was not under the root.
+type journalTree struct {
+	ClassName  string                   `json:"class"`
+	Referent   string                   `json:"referent,omitempty"`
+	IsService  bool                     `json:"service,omitempty"`
+	Properties map[string]*journalValue `json:"properties"`
+	Children   []*journalTree           `json:"children"`
+}
+
+// journalValue is a property value. The value of a reference is the number of
+// the referred instance.
+type journalValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// journalAction is a single action. The meaning of Old and New depend on the
+// type of action.
+type journalAction struct {
+	Type     string           `json:"type"`
+	Label    string           `json:"label,omitempty"`
+	Instance int              `json:"instance,omitempty"`
+	Index    int              `json:"index,omitempty"`
+	Property string           `json:"property,omitempty"`
+	Old      json.RawMessage  `json:"old,omitempty"`
+	New      json.RawMessage  `json:"new,omitempty"`
+	Actions  []*journalAction `json:"actions,omitempty"`
+}
+
+// Types of journalAction.
+const (
+	journalGroup        = "Group"
+	journalAddRoot      = "AddRootInstance"
+	journalRemoveRoot   = "RemoveRootInstance"
+	journalSetClassName = "SetClassName"
+	journalSetReference = "SetReference"
+	journalSetParent    = "SetParent"
+	journalSetIsService = "SetIsService"
+	journalSetProperty  = "SetProperty"
+)
+
+////////////////
+
+type journalEncoder struct {
+	root     *rbxfile.Root
+	journal  *Journal
+	ids      map[*rbxfile.Instance]int
+	detached map[*rbxfile.Instance]int
+	// err is the first error that occurred while encoding a value.
+	err error
+}
+
+// EncodeJournal returns a Journal representing a history, as returned by
+// Controller.History. The actions of the history apply to root, which must
+// be in the current state.
+//
+// Only actions created by this package, and groups of such actions, can be
+// encoded.
+func EncodeJournal(root *rbxfile.Root, nodes []action.Node, current int) (*Journal, error) {
+	e := &journalEncoder{
+		root:     root,
+		journal:  &Journal{Current: current, Nodes: make([]*journalNode, len(nodes))},
+		ids:      map[*rbxfile.Instance]int{},
+		detached: map[*rbxfile.Instance]int{},
+	}
+	for i, node := range nodes {
+		j := &journalNode{Parent: node.Parent, Time: node.Time, Redo: node.Redo}
+		if node.Action != nil {
+			var err error
+			if j.Action, err = e.action(node.Action); err != nil {
+				return nil, err
+			}
+		}
+		e.journal.Nodes[i] = j
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.journal, nil
+}
+
+// id returns the number referring to inst, adding it to the journal if
+// necessary.
+func (e *journalEncoder) id(inst *rbxfile.Instance) int {
+	if inst == nil {
+		return 0
+	}
+	if id, ok := e.ids[inst]; ok {
+		return id
+	}
+
+	var path []int
+	top := inst
+	for parent := top.Parent(); parent != nil; parent = top.Parent() {
+		path = append(path, indexOf(parent.Children, top))
+		top = parent
+	}
+	loc := journalInstance{}
+	if i := indexOf(e.root.Instances, top); i >= 0 {
+		path = append(path, i)
+	} else {
+		tree, ok := e.detached[top]
+		if !ok {
+			tree = len(e.journal.Detached) + 1
+			e.detached[top] = tree
+			e.journal.Detached = append(e.journal.Detached, nil)
+			// The tree may contain references to itself, so it is added
+			// after the instance is registered.
+			defer func() { e.journal.Detached[tree-1] = e.tree(top) }()
+		}
+		loc.Tree = tree
+	}
+	loc.Path = make([]int, len(path))
+	for i, index := range path {
+		loc.Path[len(path)-1-i] = index
+	}
+
+	e.journal.Instances = append(e.journal.Instances, loc)
+	id := len(e.journal.Instances)
+	e.ids[inst] = id
+	return id
+}
+
+func indexOf(children []*rbxfile.Instance, inst *rbxfile.Instance) int {
+	for i, child := range children {
+		if child == inst {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *journalEncoder) tree(inst *rbxfile.Instance) *journalTree {
+	t := &journalTree{
+		ClassName:  inst.ClassName,
+		Referent:   inst.Reference,
+		IsService:  inst.IsService,
+		Properties: make(map[string]*journalValue, len(inst.Properties)),
+		Children:   make([]*journalTree, len(inst.Children)),
+	}
+	for name, value := range inst.Properties {
+		if value != nil {
+			t.Properties[name] = e.value(value)
+		}
+	}
+	for i, child := range inst.Children {
+		t.Children[i] = e.tree(child)
+	}
+	return t
+}
+
+func (e *journalEncoder) value(value rbxfile.Value) *journalValue {
+	v := &journalValue{Type: value.Type().String()}
+	if ref, ok := value.(rbxfile.ValueReference); ok {
+		v.Value = e.raw(e.id(ref.Instance))
+	} else {
+		v.Value = e.raw(value)
+	}
+	return v
+}
+
+// raw encodes v as JSON. Values such as NaN cannot be encoded, in which case
+// the error is retained, and returned by EncodeJournal.
+func (e *journalEncoder) raw(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode %T value: %s", v, err)
+		}
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+func (e *journalEncoder) action(a action.Action) (*journalAction, error) {
+	switch a := a.(type) {
+	case action.Labeled:
+		j, err := e.action(a.Action)
+		if err != nil {
+			return nil, err
+		}
+		j.Label = a.Label
+		return j, nil
+	case action.Group:
+		j := &journalAction{Type: journalGroup, Actions: make([]*journalAction, len(a))}
+		for i, a := range a {
+			var err error
+			if j.Actions[i], err = e.action(a); err != nil {
+				return nil, err
+			}
+		}
+		return j, nil
+	case *actionAddRoot:
+		return &journalAction{Type: journalAddRoot, Instance: e.id(a.instance)}, nil
+	case *actionRemoveRoot:
+		return &journalAction{Type: journalRemoveRoot, Instance: e.id(a.instance), Index: a.index}, nil
+	case *actionSetClassName:
+		return &journalAction{
+			Type:     journalSetClassName,
+			Instance: e.id(a.instance),
+			Old:      e.raw(a.oldClassName),
+			New:      e.raw(a.newClassName),
+		}, nil
+	case *actionSetReference:
+		return &journalAction{
+			Type:     journalSetReference,
+			Instance: e.id(a.instance),
+			Old:      e.raw(a.oldRef),
+			New:      e.raw(a.newRef),
+		}, nil
+	case *actionSetParent:
+		return &journalAction{
+			Type:     journalSetParent,
+			Instance: e.id(a.instance),
+			Index:    a.oldIndex,
+			Old:      e.raw(e.id(a.oldParent)),
+			New:      e.raw(e.id(a.newParent)),
+		}, nil
+	case *actionSetIsService:
+		return &journalAction{
+			Type:     journalSetIsService,
+			Instance: e.id(a.instance),
+			Old:      e.raw(a.oldIsService),
+			New:      e.raw(a.newIsService),
+		}, nil
+	case *actionSetProperty:
+		j := &journalAction{
+			Type:     journalSetProperty,
+			Instance: e.id(a.instance),
+			Property: a.prop,
+		}
+		if a.oldValue != nil {
+			j.Old = e.raw(e.value(a.oldValue))
+		}
+		if a.newValue != nil {
+			j.New = e.raw(e.value(a.newValue))
+		}
+		return j, nil
+	}
+	return nil, fmt.Errorf("cannot encode action of type %T", a)
+}
+
+////////////////
+
+type journalDecoder struct {
+	root      *rbxfile.Root
+	journal   *Journal
+	instances []*rbxfile.Instance
+	detached  []*rbxfile.Instance
+}
+
+// Decode returns the history of the journal, applying to root, which can be
+// passed to Controller.SetHistory. root must be in the same state as when the
+// journal was encoded. The returned actions are already set up.
+func (j *Journal) Decode(root *rbxfile.Root) (nodes []action.Node, current int, err error) {
+	if j.Current < 0 || j.Current >= len(j.Nodes) {
+		return nil, 0, errors.New("current state out of range")
+	}
+	d := &journalDecoder{
+		root:      root,
+		journal:   j,
+		instances: make([]*rbxfile.Instance, len(j.Instances)),
+		detached:  make([]*rbxfile.Instance, len(j.Detached)),
+	}
+	nodes = make([]action.Node, len(j.Nodes))
+	for i, node := range j.Nodes {
+		if node == nil {
+			return nil, 0, fmt.Errorf("state %d is empty", i)
+		}
+		if node.Parent >= i || (node.Parent < 0) != (i == 0) {
+			return nil, 0, fmt.Errorf("state %d has invalid parent", i)
+		}
+		nodes[i] = action.Node{Parent: node.Parent, Time: node.Time, Redo: node.Redo}
+		if i == 0 {
+			continue
+		}
+		if nodes[i].Action, err = d.action(node.Action); err != nil {
+			return nil, 0, fmt.Errorf("state %d: %s", i, err)
+		}
+	}
+	return nodes, j.Current, nil
+}
+
+// instance returns the instance referred to by id.
+func (d *journalDecoder) instance(id int) (*rbxfile.Instance, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	if id < 0 || id > len(d.instances) {
+		return nil, fmt.Errorf("instance %d out of range", id)
+	}
+	if inst := d.instances[id-1]; inst != nil {
+		return inst, nil
+	}
+
+	loc := d.journal.Instances[id-1]
+	if len(loc.Path) == 0 {
+		return nil, fmt.Errorf("instance %d has no path", id)
+	}
+	var inst *rbxfile.Instance
+	var err error
+	path := loc.Path
+	if loc.Tree == 0 {
+		if path[0] < 0 || path[0] >= len(d.root.Instances) {
+			return nil, fmt.Errorf("instance %d not found", id)
+		}
+		inst = d.root.Instances[path[0]]
+		path = path[1:]
+	} else if inst, err = d.tree(loc.Tree); err != nil {
+		return nil, err
+	}
+	for _, i := range path {
+		if i < 0 || i >= len(inst.Children) {
+			return nil, fmt.Errorf("instance %d not found", id)
+		}
+		inst = inst.Children[i]
+	}
+	d.instances[id-1] = inst
+	return inst, nil
+}
+
+// tree returns the root of the detached tree referred to by n, creating it if
+// necessary.
+func (d *journalDecoder) tree(n int) (*rbxfile.Instance, error) {
+	if n < 0 || n > len(d.detached) {
+		return nil, fmt.Errorf("tree %d out of range", n)
+	}
+	if inst := d.detached[n-1]; inst != nil {
+		return inst, nil
+	}
+
+	// Create the structure of the tree before setting properties, which may
+	// refer to instances within the tree.
+	type pending struct {
+		inst *rbxfile.Instance
+		tree *journalTree
+	}
+	var trees []pending
+	var create func(t *journalTree, parent *rbxfile.Instance) (*rbxfile.Instance, error)
+	create = func(t *journalTree, parent *rbxfile.Instance) (*rbxfile.Instance, error) {
+		inst := rbxfile.NewInstance(t.ClassName, nil)
+		inst.Reference = t.Referent
+		inst.IsService = t.IsService
+		if parent != nil {
+			if err := inst.SetParent(parent); err != nil {
+				return nil, err
+			}
+		}
+		trees = append(trees, pending{inst, t})
+		for _, child := range t.Children {
+			if _, err := create(child, inst); err != nil {
+				return nil, err
+			}
+		}
+		return inst, nil
+	}
+	t := d.journal.Detached[n-1]
+	if t == nil {
+		return nil, fmt.Errorf("tree %d is empty", n)
+	}
+	top, err := create(t, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.detached[n-1] = top
+
+	for _, p := range trees {
+		for name, v := range p.tree.Properties {
+			if v == nil {
+				continue
+			}
+			value, err := d.value(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %s", p.inst.GetFullName(), name, err)
+			}
+			p.inst.Properties[name] = value
+		}
+	}
+	return top, nil
+}
+
+func (d *journalDecoder) value(v *journalValue) (rbxfile.Value, error) {
+	typ := rbxfile.TypeFromString(v.Type)
+	if typ == rbxfile.TypeInvalid {
+		return nil, fmt.Errorf("unknown type %q", v.Type)
+	}
+	if typ == rbxfile.TypeReference {
+		var id int
+		if err := json.Unmarshal(v.Value, &id); err != nil {
+			return nil, err
+		}
+		inst, err := d.instance(id)
+		if err != nil {
+			return nil, err
+		}
+		return rbxfile.ValueReference{Instance: inst}, nil
+	}
+	value := reflect.New(reflect.TypeOf(rbxfile.NewValue(typ)))
+	if err := json.Unmarshal(v.Value, value.Interface()); err != nil {
+		return nil, err
+	}
+	return value.Elem().Interface().(rbxfile.Value), nil
+}
+
+// optionalValue decodes a property value that may be absent.
+func (d *journalDecoder) optionalValue(raw json.RawMessage) (rbxfile.Value, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var v journalValue
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return d.value(&v)
+}
+
+// instanceValue decodes a number referring to an instance.
+func (d *journalDecoder) instanceValue(raw json.RawMessage) (*rbxfile.Instance, error) {
+	var id int
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return nil, err
+	}
+	return d.instance(id)
+}
+
+func (d *journalDecoder) action(j *journalAction) (action.Action, error) {
+	if j == nil {
+		return nil, errors.New("empty action")
+	}
+	a, err := d.unlabeledAction(j)
+	if err != nil || j.Label == "" {
+		return a, err
+	}
+	return action.Labeled{Action: a, Label: j.Label}, nil
+}
+
+func (d *journalDecoder) unlabeledAction(j *journalAction) (action.Action, error) {
+	if j.Type == journalGroup {
+		a := make(action.Group, len(j.Actions))
+		for i, j := range j.Actions {
+			var err error
+			if a[i], err = d.action(j); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+
+	inst, err := d.instance(j.Instance)
+	if err != nil {
+		return nil, err
+	}
+	if inst == nil {
+		return nil, fmt.Errorf("%s requires an instance", j.Type)
+	}
+	switch j.Type {
+	case journalAddRoot:
+		return &actionAddRoot{root: d.root, instance: inst}, nil
+	case journalRemoveRoot:
+		return &actionRemoveRoot{root: d.root, index: j.Index, instance: inst}, nil
+	case journalSetClassName:
+		a := &actionSetClassName{instance: inst}
+		if err := d.stringPair(j, &a.oldClassName, &a.newClassName); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case journalSetReference:
+		a := &actionSetReference{instance: inst}
+		if err := d.stringPair(j, &a.oldRef, &a.newRef); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case journalSetParent:
+		a := &actionSetParent{instance: inst, oldIndex: j.Index}
+		if a.oldParent, err = d.instanceValue(j.Old); err != nil {
+			return nil, err
+		}
+		if a.newParent, err = d.instanceValue(j.New); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case journalSetIsService:
+		a := &actionSetIsService{instance: inst}
+		if err := json.Unmarshal(j.Old, &a.oldIsService); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(j.New, &a.newIsService); err != nil {
+			return nil, err
+		}
+		return a, nil
+	case journalSetProperty:
+		a := &actionSetProperty{instance: inst, prop: j.Property}
+		if a.oldValue, err = d.optionalValue(j.Old); err != nil {
+			return nil, err
+		}
+		if a.newValue, err = d.optionalValue(j.New); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unknown action type %q", j.Type)
+}
+
+func (d *journalDecoder) stringPair(j *journalAction, old, new *string) error {
+	if err := json.Unmarshal(j.Old, old); err != nil {
+		return err
+	}
+	return json.Unmarshal(j.New, new)
+}
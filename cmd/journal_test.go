@@ -0,0 +1,158 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/anaminus/rbxplore/diff"
+	"github.com/anaminus/rbxplore/format"
+	"github.com/robloxapi/rbxfile"
+)
+
+func newInstance(class, name string, parent *rbxfile.Instance) *rbxfile.Instance {
+	inst := rbxfile.NewInstance(class, nil)
+	inst.SetName(name)
+	if parent != nil {
+		inst.SetParent(parent)
+	}
+	return inst
+}
+
+func text(t *testing.T, root *rbxfile.Root) string {
+	var buf bytes.Buffer
+	if err := diff.WriteText(&buf, root); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// states returns the text of the tree in each state of the history of ac,
+// then returns to the current state.
+func states(t *testing.T, ac *action.Controller, root *rbxfile.Root) []string {
+	nodes, current := ac.History()
+	texts := make([]string, len(nodes))
+	for i, node := range nodes {
+		if err := ac.Goto(node.Position); err != nil {
+			t.Fatalf("goto state %d: %s", i, err)
+		}
+		texts[i] = text(t, root)
+	}
+	if err := ac.Goto(nodes[current].Position); err != nil {
+		t.Fatalf("goto current state: %s", err)
+	}
+	return texts
+}
+
+func TestJournal(t *testing.T) {
+	root := &rbxfile.Root{}
+	model := newInstance("Model", "Model", nil)
+	folder := newInstance("Folder", "Folder", nil)
+	root.Instances = []*rbxfile.Instance{model, folder}
+	p := newInstance("Part", "P", model)
+	p.Properties["Target"] = rbxfile.ValueReference{}
+	q := newInstance("Part", "Q", model)
+
+	ac := action.CreateController(100)
+	do := func(a action.Action) {
+		if err := ac.Do(a); err != nil {
+			t.Fatalf("do %s: %s", action.Describe(a), err)
+		}
+	}
+	do(cmd.SetProperty(p, "Name", rbxfile.ValueString("P2")))
+	do(cmd.SetParent(q, nil))
+	do(cmd.SetParent(p, folder))
+	// Refers to an instance that is no longer in the tree.
+	do(cmd.SetProperty(p, "Target", rbxfile.ValueReference{Instance: q}))
+	if err := ac.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ac.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	do(action.Group{
+		cmd.SetProperty(p, "Target", rbxfile.ValueReference{Instance: folder}),
+		cmd.SetClassName(folder, "Configuration"),
+	})
+
+	want := states(t, ac, root)
+	nodes, current := ac.History()
+	journal, err := cmd.EncodeJournal(root, nodes, current)
+	if err != nil {
+		t.Fatalf("encode journal: %s", err)
+	}
+	b, err := json.Marshal(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the history onto a copy of the tree read from a file.
+	var file bytes.Buffer
+	if err := format.Encode(&file, format.RBXMX, root, format.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := format.Decode(&file, format.RBXMX, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded cmd.Journal
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	restoredNodes, restoredCurrent, err := decoded.Decode(restored)
+	if err != nil {
+		t.Fatalf("decode journal: %s", err)
+	}
+	rc := action.CreateController(100)
+	rc.SetHistory(restoredNodes, restoredCurrent)
+
+	if got := text(t, restored); got != want[current] {
+		t.Fatalf("restored tree differs:\n%s\nwant:\n%s", got, want[current])
+	}
+	got := states(t, rc, restored)
+	if len(got) != len(want) {
+		t.Fatalf("got %d states, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("state %d differs:\n%s\nwant:\n%s", i, got[i], want[i])
+		}
+	}
+
+	// Undo and redo follow the same states as the original history.
+	for i := current; nodes[i].Parent >= 0; i = nodes[i].Parent {
+		if err := rc.Undo(); err != nil {
+			t.Fatalf("undo from state %d: %s", i, err)
+		}
+		if got := text(t, restored); got != want[nodes[i].Parent] {
+			t.Errorf("undo from state %d differs:\n%s\nwant:\n%s", i, got, want[nodes[i].Parent])
+		}
+	}
+	for i := 0; ; {
+		next := nodes[i].Redo
+		if next < 0 {
+			break
+		}
+		if err := rc.Redo(); err != nil {
+			t.Fatalf("redo from state %d: %s", i, err)
+		}
+		if got := text(t, restored); got != want[next] {
+			t.Errorf("redo to state %d differs:\n%s\nwant:\n%s", next, got, want[next])
+		}
+		i = next
+	}
+}
+
+func TestJournalInvalid(t *testing.T) {
+	root := &rbxfile.Root{}
+	for _, j := range []cmd.Journal{
+		{Current: 1},
+		{Current: 0, Nodes: nil},
+	} {
+		if _, _, err := j.Decode(root); err == nil {
+			t.Errorf("decoded invalid journal %+v", j)
+		}
+	}
+}
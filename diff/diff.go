@@ -0,0 +1,245 @@
+// Package diff compares trees of instances.
+package diff
+
+import (
+	"sort"
+
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxfile"
+)
+
+// Matching pairs instances of one tree with the corresponding instances of
+// another tree.
+type Matching struct {
+	// AB maps instances of the first tree to instances of the second tree.
+	AB map[*rbxfile.Instance]*rbxfile.Instance
+	// BA maps instances of the second tree to instances of the first tree.
+	BA map[*rbxfile.Instance]*rbxfile.Instance
+}
+
+func (m *Matching) pair(a, b *rbxfile.Instance) {
+	m.AB[a] = b
+	m.BA[b] = a
+}
+
+// referents returns a map of each unique referent in root to its instance.
+func referents(root *rbxfile.Root) map[string]*rbxfile.Instance {
+	refs := map[string]*rbxfile.Instance{}
+	dupes := map[string]bool{}
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		if inst.Reference == "" {
+			return true
+		}
+		if _, ok := refs[inst.Reference]; ok {
+			dupes[inst.Reference] = true
+		}
+		refs[inst.Reference] = inst
+		return true
+	})
+	for ref := range dupes {
+		delete(refs, ref)
+	}
+	return refs
+}
+
+// identity returns a key used to match instances by name and class.
+func identity(inst *rbxfile.Instance) string {
+	return inst.ClassName + "\x00" + inst.Name()
+}
+
+// Match pairs the instances of a with the instances of b. Instances are
+// first matched by referent, so that an instance whose class was changed is
+// still matched. Remaining instances are matched by name and
+// class among the children of matched parents, then by full name and class
+// anywhere in the tree, when such a pairing is unambiguous.
+func Match(a, b *rbxfile.Root) *Matching {
+	m := &Matching{
+		AB: map[*rbxfile.Instance]*rbxfile.Instance{},
+		BA: map[*rbxfile.Instance]*rbxfile.Instance{},
+	}
+
+	// Referents.
+	refsA := referents(a)
+	for ref, ib := range referents(b) {
+		if ia, ok := refsA[ref]; ok {
+			m.pair(ia, ib)
+		}
+	}
+
+	// Siblings of matched parents, top-down.
+	var matchChildren func(ca, cb []*rbxfile.Instance)
+	matchChildren = func(ca, cb []*rbxfile.Instance) {
+		for _, ib := range cb {
+			if _, ok := m.BA[ib]; ok {
+				continue
+			}
+			for _, ia := range ca {
+				if _, ok := m.AB[ia]; !ok && identity(ia) == identity(ib) {
+					m.pair(ia, ib)
+					break
+				}
+			}
+		}
+		for _, ib := range cb {
+			if ia, ok := m.BA[ib]; ok {
+				matchChildren(ia.Children, ib.Children)
+			}
+		}
+	}
+	matchChildren(a.Instances, b.Instances)
+
+	// Unique paths anywhere in the tree.
+	unmatched := func(root *rbxfile.Root, matched map[*rbxfile.Instance]*rbxfile.Instance) map[string][]*rbxfile.Instance {
+		paths := map[string][]*rbxfile.Instance{}
+		walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+			if _, ok := matched[inst]; !ok {
+				key := inst.ClassName + "\x00" + walk.FullName(inst)
+				paths[key] = append(paths[key], inst)
+			}
+			return true
+		})
+		return paths
+	}
+	pathsA := unmatched(a, m.AB)
+	for key, ib := range unmatched(b, m.BA) {
+		if ia := pathsA[key]; len(ia) == 1 && len(ib) == 1 {
+			m.pair(ia[0], ib[0])
+		}
+	}
+
+	return m
+}
+
+// Instance describes an instance that was added or removed.
+type Instance struct {
+	Path      string `json:"path"`
+	ClassName string `json:"class"`
+}
+
+// Move describes an instance that has a different parent.
+type Move struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	ClassName string `json:"class"`
+}
+
+// Change describes a property that differs between two matched instances.
+// Old is empty when the property was added, and New is empty when the
+// property was removed.
+type Change struct {
+	Path     string `json:"path"`
+	Property string `json:"property"`
+	OldType  string `json:"oldType,omitempty"`
+	Old      string `json:"old,omitempty"`
+	NewType  string `json:"newType,omitempty"`
+	New      string `json:"new,omitempty"`
+}
+
+// Result contains the differences between two trees.
+type Result struct {
+	Added   []Instance `json:"added"`
+	Removed []Instance `json:"removed"`
+	Moved   []Move     `json:"moved"`
+	Changed []Change   `json:"changed"`
+}
+
+// Empty returns whether there are no differences.
+func (r *Result) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Moved) == 0 && len(r.Changed) == 0
+}
+
+// Compare returns the differences between tree a and tree b.
+func Compare(a, b *rbxfile.Root) *Result {
+	m := Match(a, b)
+	r := &Result{
+		Added:   []Instance{},
+		Removed: []Instance{},
+		Moved:   []Move{},
+		Changed: []Change{},
+	}
+	walk.Walk(a, func(ia *rbxfile.Instance, _ int) bool {
+		ib, ok := m.AB[ia]
+		if !ok {
+			r.Removed = append(r.Removed, Instance{Path: walk.FullName(ia), ClassName: ia.ClassName})
+			return true
+		}
+		if pa, pb := ia.Parent(), ib.Parent(); pa == nil && pb != nil || pa != nil && m.AB[pa] != pb {
+			r.Moved = append(r.Moved, Move{From: walk.FullName(ia), To: walk.FullName(ib), ClassName: ib.ClassName})
+		}
+		r.Changed = append(r.Changed, compareProperties(m, ia, ib)...)
+		return true
+	})
+	walk.Walk(b, func(ib *rbxfile.Instance, _ int) bool {
+		if _, ok := m.BA[ib]; !ok {
+			r.Added = append(r.Added, Instance{Path: walk.FullName(ib), ClassName: ib.ClassName})
+		}
+		return true
+	})
+	return r
+}
+
+// Display returns a string representation of a property value. Referenced
+// instances are displayed as paths.
+func Display(v rbxfile.Value) string {
+	if ref, ok := v.(rbxfile.ValueReference); ok {
+		if ref.Instance == nil {
+			return "nil"
+		}
+		return walk.FullName(ref.Instance)
+	}
+	return v.String()
+}
+
+// Equal returns whether two values are equal. Because references point into
+// different trees, referenced instances are compared through the matching.
+func (m *Matching) Equal(a, b rbxfile.Value) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+	if ra, ok := a.(rbxfile.ValueReference); ok {
+		rb := b.(rbxfile.ValueReference)
+		if ra.Instance == nil || rb.Instance == nil {
+			return ra.Instance == nil && rb.Instance == nil
+		}
+		return m.AB[ra.Instance] == rb.Instance
+	}
+	return a.String() == b.String()
+}
+
+func compareProperties(m *Matching, ia, ib *rbxfile.Instance) []Change {
+	path := walk.FullName(ib)
+	names := make([]string, 0, len(ia.Properties)+len(ib.Properties))
+	for name := range ia.Properties {
+		names = append(names, name)
+	}
+	for name := range ib.Properties {
+		if _, ok := ia.Properties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []Change
+	if ia.ClassName != ib.ClassName {
+		changes = append(changes, Change{Path: path, Property: "ClassName", OldType: "string", Old: ia.ClassName, NewType: "string", New: ib.ClassName})
+	}
+	for _, name := range names {
+		va, vb := ia.Properties[name], ib.Properties[name]
+		switch {
+		case va == nil:
+			changes = append(changes, Change{Path: path, Property: name, NewType: vb.Type().String(), New: Display(vb)})
+		case vb == nil:
+			changes = append(changes, Change{Path: path, Property: name, OldType: va.Type().String(), Old: Display(va)})
+		case !m.Equal(va, vb):
+			changes = append(changes, Change{
+				Path:     path,
+				Property: name,
+				OldType:  va.Type().String(),
+				Old:      Display(va),
+				NewType:  vb.Type().String(),
+				New:      Display(vb),
+			})
+		}
+	}
+	return changes
+}
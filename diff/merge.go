@@ -0,0 +1,360 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anaminus/rbxplore/validate"
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxfile"
+)
+
+// Conflict describes an edit made by both sides of a merge that could not
+// be reconciled. Empty values indicate that the property or instance does
+// not exist on that side.
+type Conflict struct {
+	Path     string
+	Property string
+	Base     string
+	Ours     string
+	Theirs   string
+}
+
+// WriteMarkers writes a conflict using the conflict markers of git.
+func (c Conflict) WriteMarkers(w io.Writer) {
+	line := func(v string) string {
+		if v == "" {
+			return "(none)"
+		}
+		return v
+	}
+	name := c.Path
+	if c.Property != "" {
+		name += "." + c.Property
+	}
+	fmt.Fprintf(w, "<<<<<<< ours\n%s: %s\n", name, line(c.Ours))
+	fmt.Fprintf(w, "||||||| base\n%s: %s\n", name, line(c.Base))
+	fmt.Fprintf(w, "=======\n%s: %s\n", name, line(c.Theirs))
+	fmt.Fprintf(w, ">>>>>>> theirs\n")
+}
+
+func describe(v rbxfile.Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.Type().String() + " = " + Text(v)
+}
+
+// merger holds the state of a three-way merge.
+type merger struct {
+	base, ours, theirs *rbxfile.Root
+	// Matchings of base to ours, and base to theirs.
+	mo, mt *Matching
+	// Copies of instances added by theirs.
+	clones map[*rbxfile.Instance]*rbxfile.Instance
+	// Referents used by instances in ours, including copies.
+	refs map[string]bool
+	// Instances in ours that were removed by theirs, but kept because of a
+	// conflict.
+	kept      map[*rbxfile.Instance]bool
+	conflicts []Conflict
+}
+
+// toOurs returns the instance in ours that corresponds to an instance in
+// theirs.
+func (m *merger) toOurs(t *rbxfile.Instance) *rbxfile.Instance {
+	if c, ok := m.clones[t]; ok {
+		return c
+	}
+	if b, ok := m.mt.BA[t]; ok {
+		return m.mo.AB[b]
+	}
+	return nil
+}
+
+// equal compares two values from different trees. Referenced instances are
+// compared by their counterparts in base, mapped by ma and mb. A nil map
+// indicates that the value is already from base.
+func (m *merger) equal(a rbxfile.Value, ma map[*rbxfile.Instance]*rbxfile.Instance, b rbxfile.Value, mb map[*rbxfile.Instance]*rbxfile.Instance) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if ra, ok := a.(rbxfile.ValueReference); ok {
+		rb := b.(rbxfile.ValueReference)
+		if ra.Instance == nil || rb.Instance == nil {
+			return ra.Instance == nil && rb.Instance == nil
+		}
+		ba, oka := ra.Instance, true
+		if ma != nil {
+			ba, oka = ma[ra.Instance]
+		}
+		bb, okb := rb.Instance, true
+		if mb != nil {
+			bb, okb = mb[rb.Instance]
+		}
+		if !oka || !okb {
+			return ra.Instance == rb.Instance
+		}
+		return ba == bb
+	}
+	return a.String() == b.String()
+}
+
+// unchanged returns whether an instance in a side of the merge has the same
+// properties as its counterpart in base.
+func (m *merger) unchanged(b, side *rbxfile.Instance, toBase map[*rbxfile.Instance]*rbxfile.Instance) bool {
+	if b.ClassName != side.ClassName || len(b.Properties) != len(side.Properties) {
+		return false
+	}
+	for name, vb := range b.Properties {
+		if !m.equal(vb, nil, side.Properties[name], toBase) {
+			return false
+		}
+	}
+	return true
+}
+
+// subtreeUnchanged returns whether an instance in ours and all of its
+// descendants are the same as its counterpart in base. Instances added or
+// moved under it by ours are changes.
+func (m *merger) subtreeUnchanged(b, o *rbxfile.Instance) bool {
+	if !m.unchanged(b, o, m.mo.BA) {
+		return false
+	}
+	for _, child := range o.Children {
+		cb, ok := m.mo.BA[child]
+		if !ok || cb.Parent() != b {
+			return false
+		}
+		if !m.subtreeUnchanged(cb, child) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *merger) conflict(c Conflict) {
+	m.conflicts = append(m.conflicts, c)
+}
+
+// clone copies an instance added by theirs, along with its descendants. A
+// copy receives a new referent if its referent is already used in ours.
+func (m *merger) clone(t *rbxfile.Instance) *rbxfile.Instance {
+	c := rbxfile.NewInstance(t.ClassName, nil)
+	c.IsService = t.IsService
+	c.Reference = t.Reference
+	if c.Reference != "" {
+		if m.refs[c.Reference] {
+			c.Reference = validate.NewReferent(func(ref string) bool { return m.refs[ref] })
+		}
+		m.refs[c.Reference] = true
+	}
+	for name, value := range t.Properties {
+		c.Properties[name] = value.Copy()
+	}
+	m.clones[t] = c
+	for _, child := range t.Children {
+		if _, ok := m.mt.BA[child]; ok {
+			// Moved into the new instance; handled with base instances.
+			continue
+		}
+		m.clone(child).SetParent(c)
+	}
+	return c
+}
+
+// Merge performs a three-way merge of trees, applying the changes made by
+// theirs relative to base onto ours. ours is modified in place. Changes that
+// conflict with changes made by ours are resolved in favor of ours, and are
+// returned.
+func Merge(base, ours, theirs *rbxfile.Root) []Conflict {
+	m := &merger{
+		base:   base,
+		ours:   ours,
+		theirs: theirs,
+		mo:     Match(base, ours),
+		mt:     Match(base, theirs),
+		clones: map[*rbxfile.Instance]*rbxfile.Instance{},
+		kept:   map[*rbxfile.Instance]bool{},
+		refs:   map[string]bool{},
+	}
+	walk.Walk(ours, func(o *rbxfile.Instance, _ int) bool {
+		if o.Reference != "" {
+			m.refs[o.Reference] = true
+		}
+		return true
+	})
+
+	// Additions made by theirs.
+	walk.Walk(theirs, func(t *rbxfile.Instance, _ int) bool {
+		if _, ok := m.mt.BA[t]; ok {
+			return true
+		}
+		parent := t.Parent()
+		if parent == nil {
+			ours.Instances = append(ours.Instances, m.clone(t))
+			return false
+		}
+		if _, ok := m.clones[parent]; ok {
+			// Already copied with its parent.
+			return false
+		}
+		p := m.toOurs(parent)
+		if p == nil {
+			m.conflict(Conflict{Path: walk.FullName(t), Theirs: "added " + t.ClassName})
+			return false
+		}
+		m.clone(t).SetParent(p)
+		return false
+	})
+
+	// Edits to instances in base.
+	walk.Walk(base, func(b *rbxfile.Instance, _ int) bool {
+		o, t := m.mo.AB[b], m.mt.AB[b]
+		path := walk.FullName(b)
+		switch {
+		case o == nil && t == nil:
+		case t == nil:
+			// Removed by theirs. An instance kept with a conflicting
+			// ancestor is kept along with it.
+			switch {
+			case m.kept[o.Parent()]:
+				m.kept[o] = true
+			case m.subtreeUnchanged(b, o):
+				removeInstance(ours, o)
+			default:
+				m.kept[o] = true
+				m.conflict(Conflict{Path: path, Base: b.ClassName, Ours: "modified " + o.ClassName})
+			}
+		case o == nil:
+			// Removed by ours.
+			if !m.unchanged(b, t, m.mt.BA) {
+				m.conflict(Conflict{Path: path, Base: b.ClassName, Theirs: "modified " + t.ClassName})
+			}
+		default:
+			m.mergeInstance(b, o, t)
+		}
+		return true
+	})
+
+	// Point references copied from theirs at instances in ours.
+	walk.Walk(ours, func(o *rbxfile.Instance, _ int) bool {
+		for name, value := range o.Properties {
+			ref, ok := value.(rbxfile.ValueReference)
+			if !ok || ref.Instance == nil {
+				continue
+			}
+			if _, inTheirs := m.mt.BA[ref.Instance]; inTheirs || m.clones[ref.Instance] != nil {
+				o.Properties[name] = rbxfile.ValueReference{Instance: m.toOurs(ref.Instance)}
+			}
+		}
+		return true
+	})
+
+	return m.conflicts
+}
+
+// mergeInstance applies the edits made by theirs to an instance that exists
+// on all sides.
+func (m *merger) mergeInstance(b, o, t *rbxfile.Instance) {
+	path := walk.FullName(o)
+
+	if b.ClassName != t.ClassName {
+		if b.ClassName == o.ClassName {
+			o.ClassName = t.ClassName
+		} else if o.ClassName != t.ClassName {
+			m.conflict(Conflict{Path: path, Property: "ClassName", Base: b.ClassName, Ours: o.ClassName, Theirs: t.ClassName})
+		}
+	}
+
+	names := map[string]bool{}
+	for name := range b.Properties {
+		names[name] = true
+	}
+	for name := range o.Properties {
+		names[name] = true
+	}
+	for name := range t.Properties {
+		names[name] = true
+	}
+	for name := range names {
+		vb, vo, vt := b.Properties[name], o.Properties[name], t.Properties[name]
+		switch {
+		case m.equal(vo, m.mo.BA, vt, m.mt.BA):
+		case m.equal(vb, nil, vt, m.mt.BA):
+			// Only ours changed.
+		case m.equal(vb, nil, vo, m.mo.BA):
+			// Only theirs changed.
+			if vt == nil {
+				delete(o.Properties, name)
+			} else {
+				o.Properties[name] = vt.Copy()
+			}
+		default:
+			m.conflict(Conflict{Path: path, Property: name, Base: describe(vb), Ours: describe(vo), Theirs: describe(vt)})
+		}
+	}
+
+	// Moves.
+	pb, po, pt := b.Parent(), o.Parent(), t.Parent()
+	movedO := !sameParent(pb, po, m.mo.AB)
+	movedT := !sameParent(pb, pt, m.mt.AB)
+	switch {
+	case !movedT:
+	case !movedO:
+		var np *rbxfile.Instance
+		if pt != nil {
+			if np = m.toOurs(pt); np == nil {
+				m.conflict(Conflict{Path: path, Property: "Parent", Base: parentName(pb), Ours: parentName(po), Theirs: parentName(pt)})
+				return
+			}
+		}
+		if np == nil {
+			o.SetParent(nil)
+			m.ours.Instances = append(m.ours.Instances, o)
+		} else {
+			if po == nil {
+				removeInstance(m.ours, o)
+			}
+			o.SetParent(np)
+		}
+	case m.toOurs(pt) != po:
+		m.conflict(Conflict{Path: path, Property: "Parent", Base: parentName(pb), Ours: parentName(po), Theirs: parentName(pt)})
+	}
+}
+
+// sameParent returns whether a parent in base corresponds to a parent on a
+// side of the merge.
+func sameParent(pb, ps *rbxfile.Instance, toSide map[*rbxfile.Instance]*rbxfile.Instance) bool {
+	if pb == nil || ps == nil {
+		return pb == nil && ps == nil
+	}
+	return toSide[pb] == ps
+}
+
+func parentName(p *rbxfile.Instance) string {
+	if p == nil {
+		return "(top level)"
+	}
+	return walk.FullName(p)
+}
+
+// removeInstance removes an instance from its parent, or from the top level
+// of root.
+func removeInstance(root *rbxfile.Root, inst *rbxfile.Instance) {
+	if inst.Parent() != nil {
+		inst.SetParent(nil)
+		return
+	}
+	for i, top := range root.Instances {
+		if top == inst {
+			copy(root.Instances[i:], root.Instances[i+1:])
+			root.Instances[len(root.Instances)-1] = nil
+			root.Instances = root.Instances[:len(root.Instances)-1]
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package diff
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+// sortedInstances returns a copy of a list of instances, sorted by name,
+// then class. Otherwise, the original order is retained.
+func sortedInstances(list []*rbxfile.Instance) []*rbxfile.Instance {
+	sorted := make([]*rbxfile.Instance, len(list))
+	copy(sorted, list)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Name() != b.Name() {
+			return a.Name() < b.Name()
+		}
+		return a.ClassName < b.ClassName
+	})
+	return sorted
+}
+
+// Text returns a canonical representation of a property value on a single
+// line. Strings are quoted, and referenced instances are displayed as paths.
+func Text(v rbxfile.Value) string {
+	switch v := v.(type) {
+	case rbxfile.ValueString:
+		return strconv.Quote(string(v))
+	case rbxfile.ValueBinaryString:
+		return strconv.Quote(string(v))
+	case rbxfile.ValueProtectedString:
+		return strconv.Quote(string(v))
+	case rbxfile.ValueContent:
+		return strconv.Quote(string(v))
+	}
+	return strings.Replace(Display(v), "\n", "\\n", -1)
+}
+
+// WriteText writes a canonical text representation of root to w. The
+// representation is deterministic, and does not depend on referents:
+// siblings are sorted by name and class, properties are sorted by name, and
+// each property is written on its own line.
+func WriteText(w io.Writer, root *rbxfile.Root) error {
+	bw := bufio.NewWriter(w)
+	var write func(inst *rbxfile.Instance, indent string)
+	write = func(inst *rbxfile.Instance, indent string) {
+		bw.WriteString(indent)
+		bw.WriteString(inst.ClassName)
+		bw.WriteString(" ")
+		bw.WriteString(strconv.Quote(inst.Name()))
+		if inst.IsService {
+			bw.WriteString(" [service]")
+		}
+		bw.WriteString("\n")
+
+		names := make([]string, 0, len(inst.Properties))
+		for name := range inst.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := inst.Properties[name]
+			bw.WriteString(indent)
+			bw.WriteString("\t.")
+			bw.WriteString(name)
+			bw.WriteString(": ")
+			bw.WriteString(value.Type().String())
+			bw.WriteString(" = ")
+			bw.WriteString(Text(value))
+			bw.WriteString("\n")
+		}
+
+		for _, child := range sortedInstances(inst.Children) {
+			write(child, indent+"\t")
+		}
+	}
+	for _, inst := range sortedInstances(root.Instances) {
+		write(inst, "")
+	}
+	return bw.Flush()
+}
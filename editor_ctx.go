@@ -5,6 +5,7 @@ import (
 	"github.com/anaminus/rbxplore/action"
 	"github.com/anaminus/rbxplore/cmd"
 	"github.com/anaminus/rbxplore/event"
+	"github.com/anaminus/rbxplore/format"
 	"github.com/anaminus/rbxplore/property"
 	"github.com/robloxapi/rbxclip"
 	"log"
@@ -362,7 +363,16 @@ type EditorContext struct {
 
 func (c *EditorContext) ChangeSession(s *Session, err error) {
 	if err == nil {
+		if Autosave != nil && c.session != s {
+			Autosave.Remove(c.session)
+			Autosave.Add(s)
+		}
 		c.session = s
+		if s != nil {
+			for _, warning := range s.Warnings {
+				log.Printf("warning: %s\n", warning)
+			}
+		}
 	} else {
 		log.Printf("failed to decode session file: %s\n", err)
 	}
@@ -415,29 +425,66 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 			Format:   c.session.Format,
 			Minified: c.session.Minified,
 		}
+		save := func() {
+			c.session.File = exportCtx.File
+			c.session.Format = exportCtx.Format
+			c.session.Minified = exportCtx.Minified
+			c.updateWindowTitle(ctxc.Window())
+			if err := c.session.EncodeFile(); err != nil {
+				ctxc.EnterContext(&AlertContext{
+					Title:   "Error",
+					Text:    "Failed to save file:\n" + err.Error(),
+					Buttons: ButtonsOKCancel,
+					Finished: func(ok, _ bool) {
+						if ok && f != nil {
+							f()
+						}
+					},
+				})
+				return
+			}
+			if f != nil {
+				f()
+			}
+		}
 		exportCtx.Finished = func(ok bool) {
-			if ok {
-				c.session.File = exportCtx.File
-				c.session.Format = exportCtx.Format
-				c.session.Minified = exportCtx.Minified
-				c.updateWindowTitle(ctxc.Window())
-				if err := c.session.EncodeFile(); err != nil {
-					ctxc.EnterContext(&AlertContext{
-						Title:   "Error",
-						Text:    "Failed to save file:\n" + err.Error(),
-						Buttons: ButtonsOKCancel,
-						Finished: func(ok, _ bool) {
-							if ok && f != nil {
-								f()
-							}
-						},
-					})
-					return
-				}
-				if f != nil {
-					f()
-				}
+			if !ok {
+				return
 			}
+			err := format.Check(exportCtx.Format, c.session.Root, Data.API)
+			if err == nil {
+				save()
+				return
+			}
+			// Offer to wrap or strip the content that cannot be saved. The
+			// change is done as an action, so that it can be undone.
+			ctxc.EnterContext(&AlertContext{
+				Title:   "Incompatible Content",
+				Text:    "Cannot save as " + exportCtx.Format.String() + ":\n" + err.Error() + "\n\nWould you like to wrap the content in a Model?\nChoose No to remove it instead.",
+				Buttons: ButtonsYesNoCancel,
+				Finished: func(ok, cancel bool) {
+					if cancel {
+						return
+					}
+					strategy := format.Strip
+					if ok {
+						strategy = format.Wrap
+					}
+					a, err := format.AdaptAction(exportCtx.Format, c.session.Root, Data.API, strategy)
+					if err == nil && a != nil {
+						err = c.session.Action.Do(action.Labeled{Action: a, Label: "Convert to " + exportCtx.Format.String()})
+					}
+					if err != nil {
+						ctxc.EnterContext(&AlertContext{
+							Title:   "Error",
+							Text:    "Failed to convert content:\n" + err.Error(),
+							Buttons: ButtonsOK,
+						})
+						return
+					}
+					save()
+				},
+			})
 		}
 		ctxc.EnterContext(exportCtx)
 	}
@@ -510,7 +557,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 			return
 		}
 		promptSaveCond("New File",
-			c.session.Unsaved,
+			c.session.Unsaved(),
 			func() {
 				c.ChangeSession(NewSession(""))
 			},
@@ -518,7 +565,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 	})
 	actionButton("Open", func() {
 		promptSaveCond("Open File",
-			c.session != nil && c.session.Unsaved && !Settings.Get("spawn_processes").(bool),
+			c.session != nil && c.session.Unsaved() && !Settings.Get("spawn_processes").(bool),
 			func() {
 				selectCtx := &FileSelectContext{
 					SelectedFile: "",
@@ -528,7 +575,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 					if selectCtx.SelectedFile == "" {
 						return
 					}
-					if c.session != nil && c.session.Unsaved && Settings.Get("spawn_processes").(bool) {
+					if c.session != nil && c.session.Unsaved() && Settings.Get("spawn_processes").(bool) {
 						if err := SpawnProcess(selectCtx.SelectedFile); err != nil {
 							log.Printf("failed to spawn process: %s\n", err)
 						}
@@ -556,12 +603,95 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		}
 		saveAs(nil)
 	})
+	actionValidate := actionButton("Validate", func() {
+		if c.session == nil {
+			return
+		}
+		ctxc.EnterContext(&ValidateContext{
+			Root:   c.session.Root,
+			Action: c.session.Action,
+			Finished: func(inst *rbxfile.Instance) {
+				if inst != nil && c.tree.Select(inst) {
+					c.tree.Show(inst)
+				}
+			},
+		})
+	})
+	undo := func() {
+		if c.session == nil {
+			return
+		}
+		if err := c.session.Action.Undo(); err != nil && err != action.NoAction {
+			ctxc.EnterContext(&AlertContext{
+				Title:   "Error",
+				Text:    "Failed to undo:\n" + err.Error(),
+				Buttons: ButtonsOK,
+			})
+		}
+	}
+	redo := func() {
+		if c.session == nil {
+			return
+		}
+		if err := c.session.Action.Redo(); err != nil && err != action.NoAction {
+			ctxc.EnterContext(&AlertContext{
+				Title:   "Error",
+				Text:    "Failed to redo:\n" + err.Error(),
+				Buttons: ButtonsOK,
+			})
+		}
+	}
+	historyButton := func(f func()) *LabelButton {
+		button := CreateLabelButton(theme, "")
+		button.SetDesiredSize(math.Size{W: 200, H: ButtonSize.H})
+		button.OnClick(func(e gxui.MouseEvent) {
+			if e.Button != gxui.MouseButtonLeft {
+				return
+			}
+			ctxc.Driver().Call(f)
+		})
+		menu.AddChild(button)
+		return button
+	}
+	actionUndo := historyButton(undo)
+	actionRedo := historyButton(redo)
+	// updateHistoryButtons describes the actions that would be undone and
+	// redone, disabling the buttons when there are none.
+	updateHistoryButtons := func() {
+		var u, r action.Action
+		if c.session != nil {
+			c.session.Action.Lock()
+			u, r = c.session.Action.UndoAction(), c.session.Action.RedoAction()
+			c.session.Action.Unlock()
+		}
+		actionUndo.SetEnabled(u != nil)
+		if u != nil {
+			actionUndo.SetText("Undo " + action.Describe(u))
+		} else {
+			actionUndo.SetText("Undo")
+		}
+		actionRedo.SetEnabled(r != nil)
+		if r != nil {
+			actionRedo.SetText("Redo " + action.Describe(r))
+		} else {
+			actionRedo.SetText("Redo")
+		}
+	}
+
+	actionHistory := actionButton("History", func() {
+		if c.session == nil {
+			return
+		}
+		ctxc.EnterContext(&HistoryContext{
+			Action: c.session.Action,
+		})
+	})
 	actionClose := actionButton("Close", func() {
 		if c.session == nil {
 			return
 		}
 		promptSaveCond("Close File",
-			c.session.Unsaved,
+			c.session.Unsaved(),
 			func() {
 				c.ChangeSession(nil, nil)
 			},
@@ -579,8 +709,16 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		if !c.tree.HasFocus() {
 			return
 		}
+		if e.Modifier == gxui.ModControl|gxui.ModShift && e.Key == gxui.KeyZ {
+			redo()
+			return
+		}
 		if e.Modifier == gxui.ModControl {
 			switch e.Key {
+			case gxui.KeyZ:
+				undo()
+			case gxui.KeyY:
+				redo()
 			case gxui.KeyC:
 				inst, _ := c.tree.Selected().(*rbxfile.Instance)
 				if inst != nil {
@@ -607,7 +745,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 								ag[i] = cmd.SetParent(inst, parent)
 							}
 						}
-						if err := c.session.Action.Do(ag); err != nil {
+						if err := c.session.Action.Do(action.Labeled{Action: ag, Label: "Paste"}); err != nil {
 							ctxc.EnterContext(&AlertContext{
 								Title:   "Error",
 								Text:    "Failed to add objects:\n" + err.Error(),
@@ -677,7 +815,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 			for i, child := range children {
 				ag[i] = cmd.SetParent(child, inst)
 			}
-			if err := c.session.Action.Do(ag); err != nil {
+			if err := c.session.Action.Do(action.Labeled{Action: ag, Label: "Add Model"}); err != nil {
 				ctxc.EnterContext(&AlertContext{
 					Title:   "Error",
 					Text:    "Failed to add objects:\n" + err.Error(),
@@ -721,6 +859,11 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		}
 		actionSave.SetVisible(c.session != nil)
 		actionSaveAs.SetVisible(c.session != nil)
+		actionValidate.SetVisible(c.session != nil)
+		actionUndo.SetVisible(c.session != nil)
+		actionRedo.SetVisible(c.session != nil)
+		actionHistory.SetVisible(c.session != nil)
+		updateHistoryButtons()
 		actionClose.SetVisible(c.session != nil)
 
 		c.updateWindowTitle(ctxc.Window())
@@ -734,6 +877,7 @@ func (c *EditorContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		if c.session != nil {
 			c.actionListener = c.session.Action.OnUpdate(func(...interface{}) {
 				c.tree.Adapter().(*rootAdapter).DataChanged(false)
+				ctxc.Driver().Call(updateHistoryButtons)
 			})
 			propPanel.SetActionController(c.session.Action)
 			root = c.session.Root
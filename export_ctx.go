@@ -3,13 +3,14 @@ package main
 import (
 	"github.com/anaminus/gxui"
 	"github.com/anaminus/gxui/math"
+	"github.com/anaminus/rbxplore/format"
 	"os"
 	"path/filepath"
 )
 
 type ExportContext struct {
 	File      string
-	Format    Format
+	Format    format.Format
 	Minified  bool
 	Finished  func(bool)
 	ok        bool
@@ -23,7 +24,7 @@ func (c *ExportContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 	dialog := CreateDialog(theme)
 	dialog.SetTitle("Save As...")
 	actionExport := dialog.AddAction("Save", true, func() {
-		if c.File == "" || c.Format == FormatNone {
+		if c.File == "" || c.Format == format.None {
 			return
 		}
 		if _, err := os.Stat(c.File); !os.IsNotExist(err) {
@@ -48,7 +49,7 @@ func (c *ExportContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		ctxc.ExitContext()
 	})
 	setCanExport := func() {
-		dialog.SetActionEnabled(actionExport, c.File != "" && c.Format != FormatNone)
+		dialog.SetActionEnabled(actionExport, c.File != "" && c.Format != format.None)
 	}
 	setCanExport()
 
@@ -82,11 +83,8 @@ func (c *ExportContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		textbox.SetText(c.File)
 		textbox.OnTextChanged(func([]gxui.TextBoxEdit) {
 			c.File = textbox.Text()
-			ext := filepath.Ext(c.File)
-			if len(ext) > 1 {
-				if f := FormatFromString(ext[1:]); f != FormatNone {
-					dropdown.Select(f)
-				}
+			if f := format.FromExt(c.File); f != format.None {
+				dropdown.Select(f)
 			}
 			setCanExport()
 		})
@@ -128,11 +126,11 @@ func (c *ExportContext) Entering(ctxc *ContextController) ([]gxui.Control, bool)
 		dropdown.SetPadding(math.Spacing{5, 5, 5, 5})
 		dropdown.SetMargin(math.Spacing{3, 3, 3, 3})
 		dropdown.OnSelectionChanged(func(item gxui.AdapterItem) {
-			if format, ok := item.(Format); !ok {
+			if f, ok := item.(format.Format); !ok {
 				dropdown.Select(c.Format)
 				return
 			} else {
-				c.Format = format
+				c.Format = f
 				setCanExport()
 			}
 		})
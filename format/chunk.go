@@ -0,0 +1,98 @@
+package format
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Size of the header of the binary format. The header consists of the magic
+// number, a 6-byte signature, a uint16 version, a uint32 class count, a
+// uint32 instance count, and 8 reserved bytes.
+const binaryHeaderLength = 32
+
+// Size of the header of each chunk in the binary format. The header consists
+// of a 4-byte name, a uint32 compressed length, a uint32 uncompressed length,
+// and 4 reserved bytes.
+const chunkHeaderLength = 16
+
+// Header contains the fields of the header of a file in the binary format.
+type Header struct {
+	Version   uint16
+	Classes   uint32
+	Instances uint32
+}
+
+// Chunk describes a chunk of a file in the binary format.
+type Chunk struct {
+	// Name of the chunk, without trailing NUL bytes.
+	Name string
+	// Offset of the chunk from the start of the file.
+	Offset int64
+	// Length of the chunk as stored in the file, including the header.
+	Length int64
+	// Compressed is the length of the compressed content, or 0 if the
+	// content is not compressed.
+	Compressed uint32
+	// Uncompressed is the length of the uncompressed content.
+	Uncompressed uint32
+}
+
+// ErrNotBinary is returned by ReadChunks when the content is not in the
+// binary format.
+var ErrNotBinary = errors.New("content is not in the binary format")
+
+// ReadChunks reads the header and the chunk headers of a file in the binary
+// format, without decoding the content of any chunk. Reading stops after the
+// END chunk.
+func ReadChunks(r io.Reader) (header Header, chunks []Chunk, err error) {
+	var buf [binaryHeaderLength]byte
+	if _, err = io.ReadFull(r, buf[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrNotBinary
+		}
+		return header, nil, err
+	}
+	if string(buf[:len(binaryMagic)]) != binaryMagic {
+		return header, nil, ErrNotBinary
+	}
+	header.Version = binary.LittleEndian.Uint16(buf[14:16])
+	header.Classes = binary.LittleEndian.Uint32(buf[16:20])
+	header.Instances = binary.LittleEndian.Uint32(buf[20:24])
+
+	offset := int64(binaryHeaderLength)
+	for {
+		if _, err = io.ReadFull(r, buf[:chunkHeaderLength]); err != nil {
+			if err == io.EOF {
+				// Missing END chunk.
+				err = nil
+			}
+			return header, chunks, err
+		}
+		chunk := Chunk{
+			Name:         strings.TrimRight(string(buf[0:4]), "\x00"),
+			Offset:       offset,
+			Compressed:   binary.LittleEndian.Uint32(buf[4:8]),
+			Uncompressed: binary.LittleEndian.Uint32(buf[8:12]),
+		}
+		length := int64(chunk.Compressed)
+		if length == 0 {
+			length = int64(chunk.Uncompressed)
+		}
+		chunk.Length = chunkHeaderLength + length
+		chunks = append(chunks, chunk)
+		offset += chunk.Length
+
+		if _, err = io.CopyN(ioutil.Discard, r, length); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return header, chunks, err
+		}
+		if chunk.Name == "END" {
+			return header, chunks, nil
+		}
+	}
+}
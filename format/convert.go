@@ -0,0 +1,208 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+)
+
+// Strategy determines how Adapt handles content that cannot be represented
+// by a format.
+type Strategy byte
+
+const (
+	// Abort leaves the content as-is, returning an error.
+	Abort Strategy = iota
+	// Strip removes incompatible top-level instances.
+	Strip
+	// Wrap moves incompatible content into a Model.
+	Wrap
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case Abort:
+		return "abort"
+	case Strip:
+		return "strip"
+	case Wrap:
+		return "wrap"
+	}
+	return ""
+}
+
+// StrategyFromString returns the strategy corresponding to the given name.
+func StrategyFromString(s string) (strategy Strategy, ok bool) {
+	switch strings.ToLower(s) {
+	case "abort":
+		return Abort, true
+	case "strip":
+		return Strip, true
+	case "wrap":
+		return Wrap, true
+	}
+	return Abort, false
+}
+
+// Incompatible is returned by Check when a format cannot represent the
+// top-level instances of a tree.
+type Incompatible struct {
+	// Format is the format being converted to.
+	Format Format
+	// Services is true when Instances are services going into a model
+	// format. Otherwise, Instances are non-service instances going into a
+	// place format.
+	Services bool
+	// Instances are the incompatible top-level instances.
+	Instances []*rbxfile.Instance
+}
+
+func (err *Incompatible) Error() string {
+	names := make([]string, 0, len(err.Instances))
+	for i, inst := range err.Instances {
+		if i == 3 {
+			names = append(names, fmt.Sprintf("and %d more", len(err.Instances)-i))
+			break
+		}
+		names = append(names, inst.Name())
+	}
+	if err.Services {
+		return fmt.Sprintf("%s is a model format, but the content contains services (%s)", err.Format, strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("%s is a place format, but the content contains non-service instances at the top level (%s)", err.Format, strings.Join(names, ", "))
+}
+
+// IsService returns whether inst is a service, either because it is marked
+// as one, or because the API describes its class as one. api may be nil.
+func IsService(inst *rbxfile.Instance, api *rbxapi.API) bool {
+	if inst.IsService {
+		return true
+	}
+	if api == nil {
+		return false
+	}
+	class := api.Classes[inst.ClassName]
+	return class != nil && class.Tag("service")
+}
+
+// Check returns an *Incompatible error if format to cannot represent root.
+// Services cannot be written to a model format, and each top-level instance
+// written to a place format must be a service. api may be nil.
+func Check(to Format, root *rbxfile.Root, api *rbxapi.API) error {
+	err := &Incompatible{Format: to}
+	switch {
+	case to.IsModel():
+		err.Services = true
+		for _, inst := range root.Instances {
+			if IsService(inst, api) {
+				err.Instances = append(err.Instances, inst)
+			}
+		}
+	case to.IsPlace():
+		for _, inst := range root.Instances {
+			if !IsService(inst, api) {
+				err.Instances = append(err.Instances, inst)
+			}
+		}
+	}
+	if len(err.Instances) == 0 {
+		return nil
+	}
+	return err
+}
+
+// Adapt checks whether format to can represent root, and if not, modifies
+// root according to the given strategy, such that it can be represented.
+// Returns the error from Check if the strategy is Abort.
+func Adapt(to Format, root *rbxfile.Root, api *rbxapi.API, strategy Strategy) error {
+	a, err := AdaptAction(to, root, api, strategy)
+	if a == nil {
+		return err
+	}
+	if err := a.Setup(); err != nil {
+		return err
+	}
+	return a.Forward()
+}
+
+// AdaptAction returns an action that performs Adapt, so that the changes can
+// be undone. The action is nil if root is already compatible, or if the
+// strategy is Abort, in which case the error from Check is returned.
+//
+// When stripping, incompatible top-level instances are removed.
+//
+// When wrapping into a model format, each service is replaced with a Model
+// of the same name, containing the children of the service. When wrapping
+// into a place format, non-service instances are moved into a single Model
+// under the Workspace, which is created if necessary.
+func AdaptAction(to Format, root *rbxfile.Root, api *rbxapi.API, strategy Strategy) (action.Action, error) {
+	err := Check(to, root, api)
+	if err == nil {
+		return nil, nil
+	}
+	incompatible := err.(*Incompatible)
+	if strategy != Strip && strategy != Wrap {
+		return nil, err
+	}
+
+	// Remove from the last, so that the index of each is not affected by
+	// earlier removals.
+	var group action.Group
+	for i := len(root.Instances) - 1; i >= 0; i-- {
+		if contains(incompatible.Instances, root.Instances[i]) {
+			group = append(group, cmd.RemoveRootInstance(root, i))
+		}
+	}
+	if strategy == Strip {
+		return group, nil
+	}
+
+	if incompatible.Services {
+		for _, service := range incompatible.Instances {
+			model := rbxfile.NewInstance("Model", nil)
+			model.SetName(service.Name())
+			for _, child := range service.Children {
+				group = append(group, cmd.SetParent(child, model))
+			}
+			group = append(group, cmd.AddRootInstance(root, model))
+		}
+		return group, nil
+	}
+
+	workspace := findWorkspace(root, api)
+	if workspace == nil {
+		workspace = rbxfile.NewInstance("Workspace", nil)
+		workspace.SetName("Workspace")
+		workspace.IsService = true
+		group = append(group, cmd.AddRootInstance(root, workspace))
+	}
+	model := rbxfile.NewInstance("Model", nil)
+	model.SetName("Model")
+	for _, inst := range incompatible.Instances {
+		group = append(group, cmd.SetParent(inst, model))
+	}
+	group = append(group, cmd.SetParent(model, workspace))
+	return group, nil
+}
+
+func findWorkspace(root *rbxfile.Root, api *rbxapi.API) *rbxfile.Instance {
+	for _, inst := range root.Instances {
+		if inst.ClassName == "Workspace" && IsService(inst, api) {
+			return inst
+		}
+	}
+	return nil
+}
+
+func contains(list []*rbxfile.Instance, inst *rbxfile.Instance) bool {
+	for _, v := range list {
+		if v == inst {
+			return true
+		}
+	}
+	return false
+}
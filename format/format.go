@@ -0,0 +1,295 @@
+// Package format implements the file formats supported by rbxplore, and the
+// rules for converting between them.
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+	"github.com/robloxapi/rbxfile/bin"
+	"github.com/robloxapi/rbxfile/xml"
+)
+
+// Format indicates the encoding of a file, and whether the file is a place
+// or a model.
+type Format byte
+
+const (
+	None Format = iota
+	RBXL
+	RBXM
+	RBXLX
+	RBXMX
+	JSON
+)
+
+// Count is the number of formats, including None.
+const Count = 6
+
+func (f Format) String() string {
+	switch f {
+	case RBXL:
+		return "rbxl"
+	case RBXM:
+		return "rbxm"
+	case RBXLX:
+		return "rbxlx"
+	case RBXMX:
+		return "rbxmx"
+	case JSON:
+		return "json"
+	}
+	return ""
+}
+
+// FromString returns the format corresponding to the given name, which is
+// the same as the usual file extension of the format, without the leading
+// dot. Returns None if the name is not recognized.
+func FromString(s string) Format {
+	switch strings.ToLower(s) {
+	case "rbxl":
+		return RBXL
+	case "rbxm":
+		return RBXM
+	case "rbxlx":
+		return RBXLX
+	case "rbxmx":
+		return RBXMX
+	case "json":
+		return JSON
+	}
+	return None
+}
+
+// FromExt returns the format indicated by the extension of a file name.
+func FromExt(file string) Format {
+	return FromString(strings.TrimPrefix(filepath.Ext(file), "."))
+}
+
+// Encoding returns the variant of the format that shares the same encoding,
+// so that place and model formats of the same encoding compare equal.
+func (f Format) Encoding() Format {
+	switch f {
+	case RBXM:
+		return RBXL
+	case RBXMX:
+		return RBXLX
+	}
+	return f
+}
+
+// Model returns the model variant of the format.
+func (f Format) Model() Format {
+	switch f {
+	case RBXL:
+		return RBXM
+	case RBXLX:
+		return RBXMX
+	}
+	return f
+}
+
+// IsModel returns whether the format is a model format.
+func (f Format) IsModel() bool {
+	return f == RBXM || f == RBXMX
+}
+
+// IsPlace returns whether the format is a place format.
+func (f Format) IsPlace() bool {
+	return f == RBXL || f == RBXLX
+}
+
+// Signatures used to detect the format of a file from its content.
+const (
+	binaryMagic = "<roblox!"
+	xmlMagic    = "<roblox "
+)
+
+// SniffLength is the number of leading bytes inspected by Sniff.
+const SniffLength = 64
+
+// Sniff inspects the leading bytes of a file, and returns the format the
+// content appears to be encoded in. Because places and models share the same
+// encoding, the place variant is returned for binary and XML content. None is
+// returned if the content is not recognized.
+func Sniff(b []byte) Format {
+	if bytes.HasPrefix(b, []byte(binaryMagic)) {
+		return RBXL
+	}
+	b = bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF"))
+	b = bytes.TrimLeft(b, " \t\r\n")
+	switch {
+	case bytes.HasPrefix(b, []byte(xmlMagic)):
+		return RBXLX
+	case bytes.HasPrefix(b, []byte("{")):
+		return JSON
+	}
+	return None
+}
+
+// Mismatch is a warning indicating that the extension of a file does not
+// agree with the content of the file.
+type Mismatch struct {
+	File      string
+	Extension Format
+	Content   Format
+}
+
+func (w Mismatch) Error() string {
+	var content string
+	switch w.Content.Encoding() {
+	case RBXL:
+		content = "binary"
+	case RBXLX:
+		content = "XML"
+	case JSON:
+		content = "JSON"
+	}
+	return fmt.Sprintf("%s: extension indicates %s, but content is %s", filepath.Base(w.File), w.Extension, content)
+}
+
+// Detect determines the format of a file from the leading bytes of its
+// content, up to SniffLength. The extension of file, followed by hint, is
+// used to choose between place and model variants. If the content is not
+// recognized, then the extension or hint is used instead. file and hint may
+// be empty.
+//
+// guessed is true when the format was determined from the content alone, in
+// which case the place variant is returned. Because a file without services
+// is more likely to be a model, the decoded tree may be passed to Refine to
+// correct the format.
+//
+// warning is a Mismatch when the extension of file does not agree with the
+// content.
+func Detect(head []byte, file string, hint Format) (f Format, guessed bool, warning error) {
+	var ext Format
+	if file != "" {
+		ext = FromExt(file)
+	}
+	switch content := Sniff(head); {
+	case content == None:
+		if ext != None {
+			return ext, false, nil
+		}
+		return hint, false, nil
+	case ext != None && ext.Encoding() == content:
+		return ext, false, nil
+	case hint != None && hint.Encoding() == content:
+		if ext != None {
+			warning = Mismatch{File: file, Extension: ext, Content: hint}
+		}
+		return hint, false, warning
+	default:
+		if ext != None {
+			warning = Mismatch{File: file, Extension: ext, Content: content}
+		}
+		return content, true, warning
+	}
+}
+
+// Refine returns the model variant of a guessed format when root does not
+// contain any services.
+func Refine(f Format, root *rbxfile.Root) Format {
+	if root != nil && !HasServices(root) {
+		return f.Model()
+	}
+	return f
+}
+
+// HasServices returns whether any top-level instance of root is a service.
+func HasServices(root *rbxfile.Root) bool {
+	for _, inst := range root.Instances {
+		if inst.IsService {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve determines the format of an output file. If explicit is not None,
+// then it is used. Otherwise, the format is guessed from the extension of
+// output, falling back to the format of the input.
+func Resolve(explicit Format, output string, input Format) Format {
+	if explicit != None {
+		return explicit
+	}
+	if f := FromExt(output); f != None {
+		return f
+	}
+	return input
+}
+
+// ErrUnknown is returned when decoding or encoding with a format that is not
+// recognized.
+var ErrUnknown = errors.New("unknown format")
+
+// Decode decodes a tree from r in format f. api is optional, and is used to
+// decode values according to the types of properties.
+func Decode(r io.Reader, f Format, api *rbxapi.API) (*rbxfile.Root, error) {
+	switch f {
+	case RBXL:
+		return bin.DeserializePlace(r, api)
+	case RBXM:
+		return bin.DeserializeModel(r, api)
+	case RBXLX, RBXMX:
+		return xml.Deserialize(r, api)
+	case JSON:
+		root := &rbxfile.Root{}
+		if err := json.NewDecoder(r).Decode(root); err != nil {
+			return nil, err
+		}
+		return root, nil
+	}
+	return nil, ErrUnknown
+}
+
+// Indent is the indentation used by text formats that are not minified.
+const Indent = "\t"
+
+// Options configures how a tree is encoded.
+type Options struct {
+	// API is optional, and is used to encode values according to the types
+	// of properties.
+	API *rbxapi.API
+
+	// Minified indicates whether text formats should be encoded without any
+	// insignificant whitespace. Otherwise, the output is indented, with
+	// properties sorted by name, so that it remains stable between encodings.
+	Minified bool
+}
+
+// Encode encodes root to w in format f.
+func Encode(w io.Writer, f Format, root *rbxfile.Root, opts Options) error {
+	indent := Indent
+	if opts.Minified {
+		indent = ""
+	}
+	switch f {
+	case RBXL:
+		return bin.SerializePlace(w, opts.API, root)
+	case RBXM:
+		return bin.SerializeModel(w, opts.API, root)
+	case RBXLX, RBXMX:
+		// The codec writes properties in sorted order.
+		doc, err := xml.RobloxCodec{}.Encode(opts.API, root)
+		if err != nil {
+			return err
+		}
+		doc.Indent = indent
+		_, err = doc.WriteTo(w)
+		return err
+	case JSON:
+		// Object keys are sorted by the encoder.
+		e := json.NewEncoder(w)
+		e.SetIndent("", indent)
+		return e.Encode(root)
+	}
+	return ErrUnknown
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/anaminus/gxui"
+	"github.com/anaminus/gxui/math"
+	"github.com/anaminus/rbxplore/action"
+)
+
+// historyAdapter lists the states in the history of a controller, from
+// newest to oldest. The AdapterItems returned by this adapter are indexes
+// into the list of nodes.
+type historyAdapter struct {
+	gxui.AdapterBase
+	nodes   []action.Node
+	current int
+	// active marks the current state and its ancestors. Other states are on
+	// abandoned branches.
+	active map[int]bool
+}
+
+func newHistoryAdapter(ac *action.Controller) *historyAdapter {
+	ac.Lock()
+	nodes, current := ac.History()
+	ac.Unlock()
+
+	a := &historyAdapter{
+		nodes:   nodes,
+		current: current,
+		active:  make(map[int]bool, len(nodes)),
+	}
+	for i := current; i >= 0; i = nodes[i].Parent {
+		a.active[i] = true
+	}
+	return a
+}
+
+func (a *historyAdapter) Count() int {
+	return len(a.nodes)
+}
+
+func (a *historyAdapter) ItemAt(index int) gxui.AdapterItem {
+	return len(a.nodes) - 1 - index
+}
+
+func (a *historyAdapter) ItemIndex(item gxui.AdapterItem) int {
+	return len(a.nodes) - 1 - item.(int)
+}
+
+func (a *historyAdapter) Create(theme gxui.Theme, index int) gxui.Control {
+	i := a.ItemAt(index).(int)
+	node := a.nodes[i]
+
+	text := "Opened"
+	if node.Action != nil {
+		text = action.Describe(node.Action)
+	}
+	if i > 0 && node.Parent != i-1 {
+		// A new branch was started from an earlier state.
+		text = "+ " + text
+	}
+	marker := "   "
+	if i == a.current {
+		marker = ">  "
+	}
+
+	label := theme.CreateLabel()
+	label.SetText(marker + node.Time.Format("15:04:05") + "   " + text)
+	if !a.active[i] {
+		cl := label.Color()
+		label.SetColor(gxui.Color{cl.R, cl.G, cl.B, 0.4})
+	}
+	return label
+}
+
+func (a *historyAdapter) Size(gxui.Theme) math.Size {
+	return math.Size{W: math.MaxSize.W, H: 20}
+}
+
+// HistoryContext lists the states in the history of Action, including
+// branches that were abandoned by doing an action after undoing. Selecting a
+// state undoes and redoes actions until that state is reached.
+type HistoryContext struct {
+	Action *action.Controller
+}
+
+func (c *HistoryContext) Entering(ctxc *ContextController) ([]gxui.Control, bool) {
+	theme := ctxc.Theme()
+
+	dialog := CreateDialog(theme)
+	dialog.SetTitle("History")
+
+	adapter := newHistoryAdapter(c.Action)
+	list := theme.CreateList()
+	list.SetAdapter(adapter)
+	list.SetDesiredSize(math.Size{W: 400, H: 400})
+	list.OnItemClicked(func(e gxui.MouseEvent, item gxui.AdapterItem) {
+		i := item.(int)
+		if i == adapter.current {
+			return
+		}
+		ctxc.ExitContext()
+		if err := c.Action.Goto(adapter.nodes[i].Position); err != nil {
+			ctxc.EnterContext(&AlertContext{
+				Title:   "Error",
+				Text:    "Failed to restore state:\n" + err.Error(),
+				Buttons: ButtonsOK,
+			})
+		}
+	})
+	dialog.Container().AddChild(list)
+
+	dialog.AddAction("Close", true, func() {
+		ctxc.ExitContext()
+	})
+	return []gxui.Control{dialog.Control()}, true
+}
+
+func (c *HistoryContext) Exiting(*ContextController) {}
+
+func (c *HistoryContext) IsDialog() bool {
+	return true
+}
+
+func (c *HistoryContext) Direction() gxui.Direction {
+	return gxui.TopToBottom
+}
+
+func (c *HistoryContext) HorizontalAlignment() gxui.HorizontalAlignment {
+	return gxui.AlignCenter
+}
+
+func (c *HistoryContext) VerticalAlignment() gxui.VerticalAlignment {
+	return gxui.AlignMiddle
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/anaminus/rbxplore/format"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// JournalExt is appended to the name of a file to get the name of the
+// journal containing its history.
+const JournalExt = ".journal"
+
+// journalFile is the content of a journal. Because actions refer to
+// instances by their location, a journal is only valid for the exact file it
+// was written with.
+type journalFile struct {
+	// Hash is the SHA-1 hash of the content of the file, in hex.
+	Hash string `json:"hash"`
+	// Time is when the file was saved.
+	Time time.Time `json:"time"`
+	*cmd.Journal
+}
+
+// writeJournal writes the history of the session to the journal of File.
+// hash is the hash of the content that was written to File. The journal is
+// removed if there is no history. Action must be locked.
+func (s *Session) writeJournal(hash []byte) error {
+	file := s.File + JournalExt
+	nodes, current := s.Action.History()
+	if len(nodes) <= 1 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	journal, err := cmd.EncodeJournal(s.Root, nodes, current)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(file, 0, func(w io.Writer) error {
+		e := json.NewEncoder(w)
+		e.SetIndent("", format.Indent)
+		return e.Encode(journalFile{
+			Hash:    hex.EncodeToString(hash),
+			Time:    time.Now(),
+			Journal: journal,
+		})
+	})
+}
+
+// readJournal restores the history of the session from the journal of File.
+// A journal that does not exist is not an error.
+func (s *Session) readJournal() error {
+	b, err := ioutil.ReadFile(s.File + JournalExt)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var journal journalFile
+	if err := json.Unmarshal(b, &journal); err != nil {
+		return err
+	}
+	if journal.Journal == nil {
+		return errors.New("journal has no history")
+	}
+
+	content, err := ioutil.ReadFile(s.File)
+	if err != nil {
+		return err
+	}
+	if sum := sha1.Sum(content); hex.EncodeToString(sum[:]) != journal.Hash {
+		return errors.New("file was changed since the journal was written")
+	}
+
+	nodes, current, err := journal.Decode(s.Root)
+	if err != nil {
+		return err
+	}
+	s.Action.SetHistory(nodes, current)
+
+	s.Action.Lock()
+	defer s.Action.Unlock()
+	s.saved = s.Action.Position()
+	return nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/anaminus/rbxplore/format"
 	"github.com/anaminus/rbxplore/settings"
 	"io"
 	"os"
@@ -20,16 +21,24 @@ var Settings settings.Settings
 
 func InitSettings() {
 	Settings = settings.Create(SettingsFileName, map[string]interface{}{
-		"rmd_file":        "",
-		"api_file":        "",
-		"icon_file":       "",
-		"rmd_update_url":  RMDUpdateURL,
-		"api_update_url":  APIUpdateURL,
-		"icon_update_url": IconUpdateURL,
-		"spawn_processes": true,
+		"rmd_file":          "",
+		"api_file":          "",
+		"icon_file":         "",
+		"rmd_update_url":    RMDUpdateURL,
+		"api_update_url":    APIUpdateURL,
+		"icon_update_url":   IconUpdateURL,
+		"spawn_processes":   true,
+		"backup_count":      float64(0),
+		"autosave_interval": float64(60),
+		"recovery_dir":      "",
+		"save_history":      false,
+		"history_size":      float64(100),
 	})
 }
 
+// StdStream is the file name that refers to standard input or output.
+const StdStream = "-"
+
 var Option struct {
 	Debug        bool
 	SettingsFile string
@@ -38,10 +47,14 @@ var Option struct {
 	OutputFile   string
 	OutputFormat string
 	New          bool
+	Recover      string
+	Jobs         int
+	Incompatible string
 	InputFile    string
+	Watch        bool
 }
 
-func shellMain() {
+func shellMain() int {
 	InitData(nil)
 
 	if Option.UpdateData {
@@ -72,26 +85,111 @@ func shellMain() {
 
 	Data.Reload(new(DataLocations).FromSettings(Settings))
 
-	session, err := NewSession(Option.InputFile)
+	if cmd := findShellCommand(flag.Args()); cmd != nil {
+		return runShellCommand(cmd, flag.Args()[1:])
+	}
+
+	var outputFormat format.Format
+	var minified bool
+	if Option.OutputFormat != "" {
+		minified = strings.HasSuffix(Option.OutputFormat, "_min")
+		outputFormat = format.FromString(strings.TrimSuffix(Option.OutputFormat, "_min"))
+		if outputFormat == format.None {
+			fmt.Fprintf(os.Stderr, "unknown format `%s`\n", Option.OutputFormat)
+			return 2
+		}
+	}
+
+	strategy, ok := format.StrategyFromString(Option.Incompatible)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown strategy `%s`\n", Option.Incompatible)
+		return 2
+	}
+
+	if inputs := flag.Args(); isBatch(inputs) {
+		if Option.OutputFile == "" || Option.OutputFile == StdStream {
+			fmt.Fprintln(os.Stderr, "an output directory must be specified to convert multiple files")
+			return 2
+		}
+		convert := func() int {
+			if batchConvert(inputs, Option.OutputFile, outputFormat, minified, strategy, Option.Jobs) > 0 {
+				return 1
+			}
+			return 0
+		}
+		if Option.Watch {
+			return runWatched(watchPaths(inputs), convert)
+		}
+		return convert()
+	}
+
+	if Option.Watch {
+		if Option.InputFile == "" || Option.InputFile == StdStream {
+			fmt.Fprintln(os.Stderr, "an input file must be specified to watch")
+			return 2
+		}
+		if Option.OutputFile == "" {
+			fmt.Fprintln(os.Stderr, "an output file must be specified to watch")
+			return 2
+		}
+		return runWatched([]string{Option.InputFile}, func() int {
+			return convertInput(outputFormat, minified, strategy)
+		})
+	}
+	return convertInput(outputFormat, minified, strategy)
+}
+
+// convertInput decodes the input file, and encodes it to the output file, if
+// one was given.
+func convertInput(outputFormat format.Format, minified bool, strategy format.Strategy) int {
+	var session *Session
+	var err error
+	if Option.InputFile == StdStream {
+		// Content sniffing cannot distinguish between places and models, so
+		// the format flag is used as a hint.
+		session, _ = NewSession("")
+		session.Format = outputFormat
+		err = session.Decode(os.Stdin)
+	} else {
+		session, err = NewSession(Option.InputFile)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "could not decode input file: ", err)
-		return
+		fmt.Fprintf(os.Stderr, "could not decode input file: %s\n", err)
+		return 1
+	}
+	for _, warning := range session.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
 	}
 
+	if Option.OutputFile == "" {
+		return 0
+	}
 	if Option.OutputFormat != "" {
-		session.Minified = strings.HasSuffix(Option.OutputFormat, "_min")
-		session.Format = FormatFromString(strings.TrimSuffix(Option.OutputFormat, "_min"))
+		session.Minified = minified
+	}
+	if Option.OutputFile == StdStream {
+		session.Format = format.Resolve(outputFormat, "", session.Format)
+	} else {
+		session.Format = format.Resolve(outputFormat, Option.OutputFile, session.Format)
+	}
+	if err := format.Adapt(session.Format, session.Root, Data.API, strategy); err != nil {
+		fmt.Fprintf(os.Stderr, "could not convert input file: %s\n", err)
+		return 1
 	}
 
-	if Option.OutputFile != "" {
-		// TODO: Unless format flag is specified, guess format from output
-		// extension, falling back to input format if necessary.
+	if Option.OutputFile == StdStream {
+		if err := session.Encode(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "could not encode output: %s\n", err)
+			return 1
+		}
+	} else {
 		session.File = Option.OutputFile
 		if err := session.EncodeFile(); err != nil {
-			fmt.Fprintf(os.Stderr, "could not encode output file: ", err)
-			return
+			fmt.Fprintf(os.Stderr, "could not encode output file: %s\n", err)
+			return 1
 		}
 	}
+	return 0
 }
 
 func guiMain(driver gxui.Driver) {
@@ -103,16 +201,27 @@ func guiMain(driver gxui.Driver) {
 	editor := &EditorContext{}
 	ctxc, _ := CreateContextController(driver, window, theme, editor)
 
+	InitAutosave()
+
 	startSession := make(chan bool, 1)
 	go func() {
 		<-startSession
 		driver.Call(func() {
 			Data.Reload(new(DataLocations).FromSettings(Settings))
-			if Option.InputFile != "" {
+			if Option.Recover != "" {
+				if Autosave != nil {
+					if info := Autosave.FindOrphan(Option.Recover); info != nil {
+						editor.ChangeSession(info.Restore())
+					}
+				}
+			} else if Option.InputFile != "" {
 				editor.ChangeSession(NewSession(Option.InputFile))
 			} else if Option.New {
 				editor.ChangeSession(NewSession(""))
 			}
+			if Option.Recover == "" && Autosave != nil {
+				offerRecovery(ctxc, editor, Autosave.FindOrphans())
+			}
 		})
 	}()
 
@@ -126,7 +235,12 @@ func guiMain(driver gxui.Driver) {
 		startSession <- true
 	}
 
-	window.OnClose(driver.Terminate)
+	window.OnClose(func() {
+		if Autosave != nil {
+			Autosave.Stop()
+		}
+		driver.Terminate()
+	})
 	window.SetPadding(math.Spacing{L: 10, T: 10, R: 10, B: 10})
 }
 
@@ -135,9 +249,20 @@ func main() {
 	flag.StringVar(&Option.SettingsFile, "settings", "", "Read and write settings from `file`. If unspecified, 'rbxplore-settings.json' is read/written from the same location as the executable.")
 	flag.BoolVar(&Option.UpdateData, "updatedata", false, "Update ReflectionMetadata and API dump files.")
 	flag.BoolVar(&Option.Shell, "shell", false, "Runs the program without a GUI.")
-	flag.StringVar(&Option.OutputFile, "output", "", "If --shell is true, export the input file to the given location. The format will be detected from the extension.")
+	flag.StringVar(&Option.OutputFile, "output", "", "If --shell is true, export the input file to the given location. The format will be detected from the extension. If '-', the file is written to standard output.")
 	flag.StringVar(&Option.OutputFormat, "format", "", "If --shell is true, export the input file with the given format. This overrides the output file extension. Valid formats are 'rbxl', 'rbxm', 'rbxlx', 'rbxmx', and 'json'. '_min' may be appended to output in a minified format, if applicable.")
 	flag.BoolVar(&Option.New, "new", false, "If running with a GUI, force a new session to be opened.")
+	flag.IntVar(&Option.Jobs, "jobs", 0, "If --shell is true, the maximum number of files to convert in parallel when converting multiple files. Defaults to the number of CPUs.")
+	flag.StringVar(&Option.Incompatible, "incompatible", "abort", "If --shell is true, determines how content that cannot be represented by the output format is handled. 'abort' fails the conversion, 'strip' removes services from models and non-service instances from places, and 'wrap' moves such content into a Model.")
+	flag.BoolVar(&Option.Watch, "watch", false, "If --shell is true, convert the input again each time it changes, until interrupted. Also applies to the pack command.")
+	flag.StringVar(&Option.Recover, "recover", "", "If running with a GUI, restore the recovery snapshot with the given `id`.")
+	InitShellCommands()
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [file...]\n\nIf --shell is true, a file of '-' is read from standard input. Multiple files, directories, or patterns may be given to convert files in batch, in which case --output specifies a directory.\n\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		printShellCommands()
+	}
 	flag.Parse()
 	Option.InputFile = flag.Arg(0)
 	InitDebug()
@@ -148,7 +273,7 @@ func main() {
 	Settings.Save()
 
 	if Option.Shell {
-		shellMain()
+		os.Exit(shellMain())
 	} else {
 		gl.StartDriver(guiMain)
 	}
@@ -0,0 +1,67 @@
+// Package project maps trees of instances to files and directories.
+package project
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+// escapeName returns name in a form that can be used as a file name on any
+// system. Characters that are not allowed in file names, along with '%' and
+// '~', are replaced with a percent-encoded form. A leading '.' is also
+// encoded, so that instances never produce hidden files, which are not owned
+// by a project. An empty name is returned as "%".
+func escapeName(name string) string {
+	switch name {
+	case "":
+		return "%"
+	case ".", "..":
+		// Never refer to the current or parent directory.
+		return strings.Repeat("%2E", len(name))
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c < 0x20, c == 0x7F, strings.IndexByte(`/\:*?"<>|%~`, c) >= 0, c == '.' && i == 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// reservedNames contains the names of files within the directory of a
+// project or instance.
+var reservedNames = map[string]bool{
+	RootFile:     true,
+	InstanceFile: true,
+	SourceFile:   true,
+}
+
+// childNames returns a file name for each instance in children, derived from
+// the name of the instance. Siblings with the same name, ignoring case, are
+// distinguished by a "~n" suffix, numbered in order from 2. Names that would
+// conflict with reserved names have their dots escaped.
+func childNames(children []*rbxfile.Instance) []string {
+	names := make([]string, len(children))
+	count := map[string]int{}
+	for i, child := range children {
+		name := escapeName(child.Name())
+		key := strings.ToLower(name)
+		if reservedNames[key] {
+			name = strings.Replace(name, ".", "%2E", -1)
+			key = strings.ToLower(name)
+		}
+		count[key]++
+		if n := count[key]; n > 1 {
+			name += "~" + strconv.Itoa(n)
+		}
+		names[i] = name
+	}
+	return names
+}
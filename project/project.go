@@ -0,0 +1,401 @@
+package project
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anaminus/rbxplore/format"
+	"github.com/anaminus/rbxplore/validate"
+	"github.com/robloxapi/rbxfile"
+)
+
+// A project is a directory representing a tree of instances. The directory
+// contains RootFile, and a directory for each top-level instance. The
+// directory of an instance contains InstanceFile, and a directory for each
+// child. The source of a script is written to SourceFile.
+const (
+	RootFile     = "project.json"
+	InstanceFile = "instance.json"
+	SourceFile   = "source.lua"
+)
+
+// ErrNotProject is returned by Unpack when the directory is not empty and is
+// not a project.
+var ErrNotProject = errors.New("directory is not empty and does not contain a project")
+
+// rootData is the content of RootFile.
+type rootData struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Children lists the directories of top-level instances, in order.
+	Children []string `json:"children"`
+}
+
+// instanceData is the content of InstanceFile.
+type instanceData struct {
+	ClassName  string                   `json:"class"`
+	Referent   string                   `json:"referent,omitempty"`
+	IsService  bool                     `json:"service,omitempty"`
+	Properties map[string]*propertyData `json:"properties"`
+	// Children lists the directories of child instances, in order.
+	Children []string `json:"children"`
+}
+
+// propertyData is a property value within InstanceFile.
+type propertyData struct {
+	Type string `json:"type"`
+	// Value is the value encoded as JSON. Strings are encoded as JSON
+	// strings, and references are encoded as the referent of the instance,
+	// or null.
+	Value json.RawMessage `json:"value,omitempty"`
+	// Base64 contains a string that is not valid UTF-8.
+	Base64 string `json:"base64,omitempty"`
+	// File names a file within the directory of the instance that contains
+	// the string.
+	File string `json:"file,omitempty"`
+}
+
+func isString(t rbxfile.Type) bool {
+	switch t {
+	case rbxfile.TypeString, rbxfile.TypeBinaryString, rbxfile.TypeProtectedString, rbxfile.TypeContent:
+		return true
+	}
+	return false
+}
+
+// stringBytes returns the content of a value of one of the string types.
+func stringBytes(v rbxfile.Value) []byte {
+	return reflect.ValueOf(v).Bytes()
+}
+
+func writeJSON(file string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", format.Indent)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append(b, '\n'), 0666)
+}
+
+func readJSON(file string, v interface{}) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return nil
+}
+
+// isHidden returns whether a file name is a dot-entry. Hidden entries, such
+// as version control directories, are never part of a project.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// clearProject prepares dir to receive a project. If dir contains a project,
+// then the files owned by the project are removed: RootFile, the directories
+// it lists, and any other directory containing InstanceFile. Other files,
+// and hidden entries, are left in place.
+func clearProject(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.MkdirAll(dir, 0755)
+		}
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	var data rootData
+	if err := readJSON(filepath.Join(dir, RootFile), &data); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotProject
+		}
+		return err
+	}
+	listed := make(map[string]bool, len(data.Children))
+	for _, name := range data.Children {
+		listed[name] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || isHidden(name) {
+			continue
+		}
+		if !listed[name] {
+			if _, err := os.Stat(filepath.Join(dir, name, InstanceFile)); err != nil {
+				continue
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return os.Remove(filepath.Join(dir, RootFile))
+}
+
+// Unpack writes root to dir as a project. If dir already contains a project,
+// it is replaced.
+func Unpack(root *rbxfile.Root, dir string) error {
+	if err := clearProject(dir); err != nil {
+		return err
+	}
+
+	// Assign a unique referent to each instance, so that references can be
+	// restored.
+	ids := map[*rbxfile.Instance]string{}
+	used := map[string]bool{}
+	var missing []*rbxfile.Instance
+	var collect func(children []*rbxfile.Instance)
+	collect = func(children []*rbxfile.Instance) {
+		for _, inst := range children {
+			if inst.Reference == "" || used[inst.Reference] {
+				missing = append(missing, inst)
+			} else {
+				used[inst.Reference] = true
+				ids[inst] = inst.Reference
+			}
+			collect(inst.Children)
+		}
+	}
+	collect(root.Instances)
+	for _, inst := range missing {
+		ref := validate.NewReferent(func(ref string) bool { return used[ref] })
+		used[ref] = true
+		ids[inst] = ref
+	}
+
+	var unpack func(inst *rbxfile.Instance, dir string) error
+	unpack = func(inst *rbxfile.Instance, dir string) error {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return err
+		}
+		data := instanceData{
+			ClassName:  inst.ClassName,
+			Referent:   ids[inst],
+			IsService:  inst.IsService,
+			Properties: make(map[string]*propertyData, len(inst.Properties)),
+			Children:   childNames(inst.Children),
+		}
+		_, isScript := ScriptExtensions[inst.ClassName]
+		for name, value := range inst.Properties {
+			prop := &propertyData{Type: value.Type().String()}
+			var err error
+			switch v := value.(type) {
+			case rbxfile.ValueReference:
+				if id, ok := ids[v.Instance]; ok {
+					prop.Value, err = json.Marshal(id)
+				} else {
+					prop.Value = json.RawMessage("null")
+				}
+			default:
+				if !isString(value.Type()) {
+					prop.Value, err = encodeValue(value)
+					break
+				}
+				b := stringBytes(value)
+				switch {
+				case isScript && name == "Source":
+					prop.File = SourceFile
+					err = ioutil.WriteFile(filepath.Join(dir, SourceFile), b, 0666)
+				case utf8.Valid(b):
+					prop.Value, err = json.Marshal(string(b))
+				default:
+					prop.Base64 = base64.StdEncoding.EncodeToString(b)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%s.%s: %s", inst.GetFullName(), name, err)
+			}
+			data.Properties[name] = prop
+		}
+		if err := writeJSON(filepath.Join(dir, InstanceFile), data); err != nil {
+			return err
+		}
+		for i, name := range data.Children {
+			if err := unpack(inst.Children[i], filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	data := rootData{
+		Metadata: root.Metadata,
+		Children: childNames(root.Instances),
+	}
+	for i, name := range data.Children {
+		if err := unpack(root.Instances[i], filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return writeJSON(filepath.Join(dir, RootFile), data)
+}
+
+// childDirs returns the directories of the children of an instance. The
+// listed directories that exist are returned first, followed by any other
+// directories within dir, sorted by name. Hidden directories, and
+// directories that do not contain InstanceFile, are ignored.
+func childDirs(dir string, listed []string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || isHidden(name) {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, name, InstanceFile)); err == nil {
+			exists[name] = true
+		}
+	}
+	var dirs []string
+	for _, name := range listed {
+		if exists[name] {
+			dirs = append(dirs, name)
+			delete(exists, name)
+		}
+	}
+	var extra []string
+	for name := range exists {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(dirs, extra...), nil
+}
+
+// pendingRef is a reference property that is resolved after each instance
+// has been read.
+type pendingRef struct {
+	inst *rbxfile.Instance
+	prop string
+	ref  string
+}
+
+// decodeProperty decodes a property read from the directory of an instance.
+func decodeProperty(dir string, prop *propertyData) (rbxfile.Value, error) {
+	typ := rbxfile.TypeFromString(prop.Type)
+	if typ == rbxfile.TypeInvalid {
+		return nil, fmt.Errorf("unknown type %q", prop.Type)
+	}
+	value := rbxfile.NewValue(typ)
+	if isString(typ) {
+		var b []byte
+		var err error
+		switch {
+		case prop.File != "":
+			b, err = ioutil.ReadFile(filepath.Join(dir, prop.File))
+		case prop.Base64 != "":
+			b, err = base64.StdEncoding.DecodeString(prop.Base64)
+		case prop.Value != nil:
+			var s string
+			err = json.Unmarshal(prop.Value, &s)
+			b = []byte(s)
+		}
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.New(reflect.TypeOf(value)).Elem()
+		v.SetBytes(b)
+		return v.Interface().(rbxfile.Value), nil
+	}
+	if prop.Value == nil {
+		return value, nil
+	}
+	v := reflect.New(reflect.TypeOf(value))
+	if err := decodeValue(prop.Value, v.Elem()); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface().(rbxfile.Value), nil
+}
+
+// Pack reads a project from dir. Directories that are not listed by their
+// parent are included after the listed directories, so that instances can
+// be added by creating directories.
+func Pack(dir string) (*rbxfile.Root, error) {
+	var data rootData
+	if err := readJSON(filepath.Join(dir, RootFile), &data); err != nil {
+		return nil, err
+	}
+	root := &rbxfile.Root{Metadata: data.Metadata}
+	if root.Metadata == nil {
+		root.Metadata = map[string]string{}
+	}
+
+	refs := map[string]*rbxfile.Instance{}
+	var pending []pendingRef
+
+	var pack func(dir string) (*rbxfile.Instance, error)
+	pack = func(dir string) (*rbxfile.Instance, error) {
+		var data instanceData
+		if err := readJSON(filepath.Join(dir, InstanceFile), &data); err != nil {
+			return nil, err
+		}
+		inst := rbxfile.NewInstance(data.ClassName, nil)
+		inst.Reference = data.Referent
+		inst.IsService = data.IsService
+		if data.Referent != "" {
+			refs[data.Referent] = inst
+		}
+		for name, prop := range data.Properties {
+			if prop.Type == rbxfile.TypeReference.String() {
+				var ref string
+				if err := json.Unmarshal(prop.Value, &ref); err != nil || ref == "" {
+					inst.Properties[name] = rbxfile.ValueReference{}
+					continue
+				}
+				pending = append(pending, pendingRef{inst: inst, prop: name, ref: ref})
+				continue
+			}
+			value, err := decodeProperty(dir, prop)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", filepath.Join(dir, InstanceFile), name, err)
+			}
+			inst.Properties[name] = value
+		}
+
+		dirs, err := childDirs(dir, data.Children)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range dirs {
+			child, err := pack(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			if err := child.SetParent(inst); err != nil {
+				return nil, err
+			}
+		}
+		return inst, nil
+	}
+
+	dirs, err := childDirs(dir, data.Children)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range dirs {
+		inst, err := pack(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		root.Instances = append(root.Instances, inst)
+	}
+
+	for _, p := range pending {
+		p.inst.Properties[p.prop] = rbxfile.ValueReference{Instance: refs[p.ref]}
+	}
+	return root, nil
+}
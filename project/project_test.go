@@ -0,0 +1,145 @@
+package project
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+func newInstance(class, name string, parent *rbxfile.Instance) *rbxfile.Instance {
+	inst := rbxfile.NewInstance(class, nil)
+	inst.Properties["Name"] = rbxfile.ValueString(name)
+	if parent != nil {
+		inst.SetParent(parent)
+	}
+	return inst
+}
+
+func testRoot() *rbxfile.Root {
+	model := newInstance("Model", "Model", nil)
+	model.Reference = "RBX1"
+	part := newInstance("Part", "Part.1", model)
+	part.Properties["Transparency"] = rbxfile.ValueFloat(math.NaN())
+	part.Properties["Mass"] = rbxfile.ValueDouble(math.Inf(1))
+	part.Properties["Size"] = rbxfile.ValueVector3{X: float32(math.Inf(-1)), Y: 1, Z: 2}
+	part.Properties["Target"] = rbxfile.ValueReference{Instance: model}
+	part.Properties["Empty"] = rbxfile.ValueReference{}
+	model.Properties["PrimaryPart"] = rbxfile.ValueReference{Instance: part}
+	script := newInstance("Script", "Script", model)
+	script.Properties["Source"] = rbxfile.ValueProtectedString("print(\"hello\")\n")
+	// Has the same name as its sibling, and no referent.
+	newInstance("Part", "Part.1", model)
+	return &rbxfile.Root{
+		Instances: []*rbxfile.Instance{model},
+		Metadata:  map[string]string{"ExplicitAutoJoints": "true"},
+	}
+}
+
+// compareTrees reports differences between two trees. References are equal
+// when they point to corresponding instances.
+func compareTrees(t *testing.T, want, got *rbxfile.Root) {
+	pairs := map[*rbxfile.Instance]*rbxfile.Instance{}
+	var match func(path string, want, got []*rbxfile.Instance)
+	match = func(path string, want, got []*rbxfile.Instance) {
+		if len(want) != len(got) {
+			t.Errorf("%s: got %d children, want %d", path, len(got), len(want))
+			return
+		}
+		for i := range want {
+			pairs[want[i]] = got[i]
+			match(path+"/"+want[i].Name(), want[i].Children, got[i].Children)
+		}
+	}
+	match("", want.Instances, got.Instances)
+
+	for w, g := range pairs {
+		path := w.GetFullName()
+		if w.ClassName != g.ClassName {
+			t.Errorf("%s: got class %s, want %s", path, g.ClassName, w.ClassName)
+		}
+		if len(w.Properties) != len(g.Properties) {
+			t.Errorf("%s: got %d properties, want %d", path, len(g.Properties), len(w.Properties))
+		}
+		for name, wv := range w.Properties {
+			gv, ok := g.Properties[name]
+			switch {
+			case !ok:
+				t.Errorf("%s.%s: missing", path, name)
+			case wv.Type() != gv.Type():
+				t.Errorf("%s.%s: got type %s, want %s", path, name, gv.Type(), wv.Type())
+			case wv.Type() == rbxfile.TypeReference:
+				wr, gr := wv.(rbxfile.ValueReference), gv.(rbxfile.ValueReference)
+				if pairs[wr.Instance] != gr.Instance {
+					t.Errorf("%s.%s: reference not restored", path, name)
+				}
+			case wv.String() != gv.String():
+				t.Errorf("%s.%s: got %s, want %s", path, name, gv.String(), wv.String())
+			}
+		}
+	}
+	for k, v := range want.Metadata {
+		if got.Metadata[k] != v {
+			t.Errorf("metadata %s: got %q, want %q", k, got.Metadata[k], v)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := testRoot()
+	if err := Unpack(root, dir); err != nil {
+		t.Fatalf("unpack: %s", err)
+	}
+
+	// Directories that are not instances are not part of the project.
+	notes := filepath.Join(dir, "notes")
+	if err := os.Mkdir(notes, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	packed, err := Pack(dir)
+	if err != nil {
+		t.Fatalf("pack: %s", err)
+	}
+	compareTrees(t, root, packed)
+
+	// Unpacking over the project keeps the directories it does not own.
+	if err := Unpack(packed, dir); err != nil {
+		t.Fatalf("unpack again: %s", err)
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("directory not owned by the project was removed: %s", err)
+	}
+	repacked, err := Pack(dir)
+	if err != nil {
+		t.Fatalf("pack again: %s", err)
+	}
+	compareTrees(t, root, repacked)
+}
+
+func TestUnpackNotProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "file.txt"), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unpack(testRoot(), dir); err != ErrNotProject {
+		t.Errorf("got error %v, want ErrNotProject", err)
+	}
+}
@@ -0,0 +1,166 @@
+package project
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/robloxapi/rbxfile"
+)
+
+// ScriptExtensions maps each class of script to the extension of the file
+// containing its source.
+var ScriptExtensions = map[string]string{
+	"Script":       ".server.lua",
+	"LocalScript":  ".client.lua",
+	"ModuleScript": ".lua",
+}
+
+// scriptSource returns the source of a script, and whether it is a script.
+func scriptSource(inst *rbxfile.Instance) ([]byte, bool) {
+	if _, ok := ScriptExtensions[inst.ClassName]; !ok {
+		return nil, false
+	}
+	switch v := inst.Properties["Source"].(type) {
+	case rbxfile.ValueProtectedString:
+		return []byte(v), true
+	case rbxfile.ValueString:
+		return []byte(v), true
+	}
+	return nil, true
+}
+
+// scriptNames returns the name of the file of each script in children,
+// given the directory names of children. A name that ends like a script
+// extension has its last dot escaped, so that the class of a script is
+// always determined by its extension. Files that would have the same name,
+// ignoring case, as another file or directory are distinguished by a "~n"
+// suffix before the extension.
+func scriptNames(children []*rbxfile.Instance, dirs []string) map[*rbxfile.Instance]string {
+	names := map[*rbxfile.Instance]string{}
+	taken := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		taken[strings.ToLower(dir)] = true
+	}
+	for _, child := range children {
+		ext, ok := ScriptExtensions[child.ClassName]
+		if !ok {
+			continue
+		}
+		base := escapeName(child.Name())
+		for _, e := range ScriptExtensions {
+			suffix := strings.TrimSuffix(e, ".lua")
+			if suffix != "" && strings.HasSuffix(strings.ToLower(base), suffix) {
+				i := len(base) - len(suffix)
+				base = base[:i] + "%2E" + base[i+1:]
+			}
+		}
+		name := base + ext
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			name = base + "~" + strconv.Itoa(n) + ext
+		}
+		taken[strings.ToLower(name)] = true
+		names[child] = name
+	}
+	return names
+}
+
+// scriptFiles returns the location of the file of each script in root,
+// relative to a directory. Each instance is located in a directory mirroring
+// its ancestors.
+func scriptFiles(root *rbxfile.Root) map[*rbxfile.Instance]string {
+	files := map[*rbxfile.Instance]string{}
+	var walk func(children []*rbxfile.Instance, dir string)
+	walk = func(children []*rbxfile.Instance, dir string) {
+		dirs := childNames(children)
+		for child, name := range scriptNames(children, dirs) {
+			files[child] = filepath.Join(dir, name)
+		}
+		for i, child := range children {
+			walk(child.Children, filepath.Join(dir, dirs[i]))
+		}
+	}
+	walk(root.Instances, "")
+	return files
+}
+
+// ExtractScripts writes the source of each Script, LocalScript, and
+// ModuleScript in root to a file within dir. Returns the number of files
+// written.
+func ExtractScripts(root *rbxfile.Root, dir string) (n int, err error) {
+	for inst, file := range scriptFiles(root) {
+		source, _ := scriptSource(inst)
+		file = filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return n, err
+		}
+		if err := ioutil.WriteFile(file, source, 0666); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// InjectScripts reads the files written by ExtractScripts from dir, and
+// returns an action that sets the source of each script whose file differs.
+// A script without a file is left unchanged. The action is nil if no scripts
+// differ.
+//
+// unmatched contains the files in dir with a script extension that do not
+// correspond to any script, relative to dir.
+func InjectScripts(root *rbxfile.Root, dir string) (a action.Action, unmatched []string, err error) {
+	files := scriptFiles(root)
+	matched := make(map[string]bool, len(files))
+	var group action.Group
+	for inst, file := range files {
+		matched[file] = true
+		source, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, nil, err
+		}
+		if old, _ := scriptSource(inst); bytes.Equal(old, source) {
+			continue
+		}
+		var value rbxfile.Value = rbxfile.ValueProtectedString(source)
+		if _, ok := inst.Properties["Source"].(rbxfile.ValueString); ok {
+			value = rbxfile.ValueString(source)
+		}
+		group = append(group, cmd.SetProperty(inst, "Source", value))
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".lua") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if !matched[rel] {
+			unmatched = append(unmatched, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(unmatched)
+
+	if len(group) > 0 {
+		a = group
+	}
+	return a, unmatched, nil
+}
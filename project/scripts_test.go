@@ -0,0 +1,37 @@
+package project
+
+import (
+	"testing"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+func TestScriptNames(t *testing.T) {
+	parent := newInstance("Folder", "Folder", nil)
+	module := newInstance("ModuleScript", "Foo.server", parent)
+	script := newInstance("Script", "Foo", parent)
+	local := newInstance("LocalScript", "Bar.CLIENT", parent)
+	first := newInstance("ModuleScript", "Baz", parent)
+	second := newInstance("ModuleScript", "baz", parent)
+	tilde := newInstance("ModuleScript", "Baz~2", parent)
+	// Has the same name as the file of a sibling script.
+	newInstance("Folder", "Foo.server.lua", parent)
+
+	want := map[*rbxfile.Instance]string{
+		module: "Foo%2Eserver.lua",
+		script: "Foo~2.server.lua",
+		local:  "Bar%2ECLIENT.client.lua",
+		first:  "Baz.lua",
+		second: "baz~2.lua",
+		tilde:  "Baz%7E2.lua",
+	}
+	got := scriptNames(parent.Children, childNames(parent.Children))
+	if len(got) != len(want) {
+		t.Errorf("got %d names, want %d", len(got), len(want))
+	}
+	for inst, name := range want {
+		if got[inst] != name {
+			t.Errorf("%s %s: got %q, want %q", inst.ClassName, inst.Name(), got[inst], name)
+		}
+	}
+}
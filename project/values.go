@@ -0,0 +1,145 @@
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+// encodeValue encodes a property value as JSON. JSON cannot represent NaN or
+// infinite numbers, so a value containing them is encoded with each such
+// number written as a string, "NaN", "+Inf", or "-Inf".
+func encodeValue(value rbxfile.Value) ([]byte, error) {
+	b, err := json.Marshal(value)
+	if _, ok := err.(*json.UnsupportedValueError); !ok {
+		return b, err
+	}
+	return json.Marshal(plainValue(reflect.ValueOf(value)))
+}
+
+// fieldName returns the name of a struct field as encoded by the json
+// package, or an empty string if the field is not encoded.
+func fieldName(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return f.Name
+}
+
+// plainValue returns v as a tree of maps, slices, and basic values, with
+// non-finite floats replaced by strings.
+func plainValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return "NaN"
+		case math.IsInf(f, 1):
+			return "+Inf"
+		case math.IsInf(f, -1):
+			return "-Inf"
+		}
+		return v.Interface()
+	case reflect.Struct:
+		m := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if name := fieldName(v.Type().Field(i)); name != "" {
+				m[name] = plainValue(v.Field(i))
+			}
+		}
+		return m
+	case reflect.Array, reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = plainValue(v.Index(i))
+		}
+		return s
+	}
+	return v.Interface()
+}
+
+// decodeValue decodes JSON written by encodeValue into v, which must be
+// settable.
+func decodeValue(b []byte, v reflect.Value) error {
+	if err := json.Unmarshal(b, v.Addr().Interface()); err == nil {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var x interface{}
+	if err := d.Decode(&x); err != nil {
+		return err
+	}
+	return setPlain(v, x)
+}
+
+// setPlain sets v from a tree decoded from the result of plainValue.
+func setPlain(v reflect.Value, x interface{}) error {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		var s string
+		switch x := x.(type) {
+		case json.Number:
+			s = x.String()
+		case string:
+			s = x
+		default:
+			return &json.UnmarshalTypeError{Value: "non-number", Type: v.Type()}
+		}
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.Struct:
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return &json.UnmarshalTypeError{Value: "non-object", Type: v.Type()}
+		}
+		for i := 0; i < v.NumField(); i++ {
+			name := fieldName(v.Type().Field(i))
+			if x, ok := m[name]; ok && name != "" {
+				if err := setPlain(v.Field(i), x); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Array, reflect.Slice:
+		s, ok := x.([]interface{})
+		if !ok || v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(v.Type(), len(s), len(s)))
+		}
+		for i := 0; i < len(s) && i < v.Len(); i++ {
+			if err := setPlain(v.Index(i), s[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v.Addr().Interface())
+}
@@ -0,0 +1,308 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError indicates that a selector could not be parsed.
+type SyntaxError struct {
+	// Offset is the byte offset within the selector where the error
+	// occurred.
+	Offset int
+	Msg    string
+}
+
+func (err *SyntaxError) Error() string {
+	return fmt.Sprintf("offset %d: %s", err.Offset, err.Msg)
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(format string, v ...interface{}) error {
+	return &SyntaxError{Offset: p.pos, Msg: fmt.Sprintf(format, v...)}
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+// skipSpace skips whitespace, returning whether any was skipped.
+func (p *parser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (p *parser) ident() string {
+	start := p.pos
+	for _, r := range p.s[p.pos:] {
+		if !isIdent(r) {
+			break
+		}
+		p.pos += len(string(r))
+	}
+	return p.s[start:p.pos]
+}
+
+// str parses a quoted string, or an identifier.
+func (p *parser) str() (string, error) {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.quoted()
+	}
+	v := p.ident()
+	if v == "" {
+		return "", p.errorf("expected name")
+	}
+	return v, nil
+}
+
+// quoted parses a string enclosed in single or double quotes. A backslash
+// escapes the following character.
+func (p *parser) quoted() (string, error) {
+	quote := p.s[p.pos]
+	var buf []byte
+	for i := p.pos + 1; i < len(p.s); i++ {
+		switch c := p.s[i]; c {
+		case '\\':
+			if i++; i < len(p.s) {
+				buf = append(buf, p.s[i])
+			}
+		case quote:
+			p.pos = i + 1
+			return string(buf), nil
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.eof() {
+			return p.errorf("expected %q, found end of selector", c)
+		}
+		return p.errorf("expected %q, found %q", c, p.peek())
+	}
+	p.pos++
+	return nil
+}
+
+// Parse parses a selector.
+//
+// A selector is a list of one or more complex selectors separated by
+// commas. An instance is matched if it is matched by any of them.
+//
+// A complex selector is a sequence of compound selectors separated by
+// combinators. Whitespace selects descendants of the instances matched by
+// the previous compound selector, and ">" selects children.
+//
+// A compound selector is a class name or "*", followed by any number of the
+// following:
+//
+//	#Name             Name is equal to Name.
+//	[Prop]            Has property Prop.
+//	[Prop=value]      Prop is equal to value.
+//	[Prop!=value]     Prop is not equal to value.
+//	[Prop^=value]     Prop begins with value.
+//	[Prop$=value]     Prop ends with value.
+//	[Prop*=value]     Prop contains value.
+//	:IsA(Class)       Class of instance is Class or inherits from Class.
+//	:not(selector)    Not matched by selector.
+//
+// Names and values may be quoted with single or double quotes. Unquoted
+// values extend to the closing bracket. Values are compared with the string
+// form of a property. Token values may also be compared with the name of
+// the enum item.
+func Parse(s string) (*Selector, error) {
+	p := &parser{s: s}
+	sel, err := p.selector()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return sel, nil
+}
+
+func (p *parser) selector() (*Selector, error) {
+	sel := &Selector{}
+	for {
+		p.skipSpace()
+		c, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+		sel.list = append(sel.list, c)
+		p.skipSpace()
+		if p.peek() != ',' {
+			return sel, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) complex() (complexSelector, error) {
+	var c complexSelector
+	comb := descendant
+	for {
+		comp, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		comp.comb = comb
+		c = append(c, comp)
+
+		space := p.skipSpace()
+		switch p.peek() {
+		case '>':
+			p.pos++
+			p.skipSpace()
+			comb = child
+			continue
+		case ',', ')', 0:
+			return c, nil
+		}
+		if !space {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+		comb = descendant
+	}
+}
+
+func (p *parser) compound() (*compound, error) {
+	comp := &compound{}
+	start := p.pos
+	if p.peek() == '*' {
+		p.pos++
+	} else {
+		comp.class = p.ident()
+	}
+	for {
+		switch p.peek() {
+		case '#':
+			p.pos++
+			name, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			comp.preds = append(comp.preds, &property{name: "Name", op: "=", value: name})
+		case '[':
+			p.pos++
+			pred, err := p.property()
+			if err != nil {
+				return nil, err
+			}
+			comp.preds = append(comp.preds, pred)
+		case ':':
+			p.pos++
+			pred, err := p.pseudo()
+			if err != nil {
+				return nil, err
+			}
+			comp.preds = append(comp.preds, pred)
+		default:
+			if p.pos == start {
+				if p.eof() {
+					return nil, p.errorf("expected selector, found end of selector")
+				}
+				return nil, p.errorf("expected selector, found %q", p.peek())
+			}
+			return comp, nil
+		}
+	}
+}
+
+var operators = []string{"!=", "^=", "$=", "*=", "="}
+
+func (p *parser) property() (predicate, error) {
+	p.skipSpace()
+	pred := &property{}
+	var err error
+	if pred.name, err = p.str(); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return pred, nil
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			pred.op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if pred.op == "" {
+		return nil, p.errorf("expected operator or \"]\"")
+	}
+	p.skipSpace()
+	if c := p.peek(); c == '"' || c == '\'' {
+		if pred.value, err = p.quoted(); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+	} else {
+		end := strings.IndexByte(p.s[p.pos:], ']')
+		if end < 0 {
+			p.pos = len(p.s)
+			return nil, p.errorf("expected \"]\", found end of selector")
+		}
+		pred.value = strings.TrimSpace(p.s[p.pos : p.pos+end])
+		p.pos += end
+	}
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	return pred, nil
+}
+
+func (p *parser) pseudo() (predicate, error) {
+	name := p.ident()
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	var pred predicate
+	switch name {
+	case "IsA":
+		class, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		pred = isA(class)
+	case "not":
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		pred = not{sel}
+	default:
+		return nil, p.errorf("unknown pseudo-class %q", name)
+	}
+	p.skipSpace()
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return pred, nil
+}
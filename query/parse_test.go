@@ -0,0 +1,158 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+)
+
+func newInstance(class, name string, parent *rbxfile.Instance) *rbxfile.Instance {
+	inst := rbxfile.NewInstance(class, nil)
+	inst.Properties["Name"] = rbxfile.ValueString(name)
+	if parent != nil {
+		inst.SetParent(parent)
+	}
+	return inst
+}
+
+// testTree returns the following tree:
+//
+//	Model Car
+//		Part Wheel (Material = Plastic)
+//		Part Body (Target = Car)
+//		Model Seat
+//			Part Cushion
+//	Folder Spare
+//		Part Wheel
+//		Script Drive
+func testTree() *rbxfile.Root {
+	car := newInstance("Model", "Car", nil)
+	wheel := newInstance("Part", "Wheel", car)
+	wheel.Properties["Material"] = rbxfile.ValueToken(256)
+	body := newInstance("Part", "Body", car)
+	body.Properties["Target"] = rbxfile.ValueReference{Instance: car}
+	seat := newInstance("Model", "Seat", car)
+	newInstance("Part", "Cushion", seat)
+	spare := newInstance("Folder", "Spare", nil)
+	newInstance("Part", "Wheel", spare)
+	drive := newInstance("Script", "Drive", spare)
+	drive.Properties["Source"] = rbxfile.ValueProtectedString("print(\"hi\")")
+	return &rbxfile.Root{Instances: []*rbxfile.Instance{car, spare}}
+}
+
+func testAPI() *rbxapi.API {
+	return &rbxapi.API{
+		Classes: map[string]*rbxapi.Class{
+			"Instance": {Name: "Instance"},
+			"Model":    {Name: "Model", Superclass: "Instance"},
+			"Folder":   {Name: "Folder", Superclass: "Instance"},
+			"BasePart": {Name: "BasePart", Superclass: "Instance"},
+			"Part": {
+				Name:       "Part",
+				Superclass: "BasePart",
+				Members: []rbxapi.Member{
+					&rbxapi.Property{MemberName: "Material", MemberClass: "Part", ValueType: "Material"},
+				},
+			},
+			"Script": {Name: "Script", Superclass: "Instance"},
+		},
+		Enums: map[string]*rbxapi.Enum{
+			"Material": {
+				Name:  "Material",
+				Items: []*rbxapi.EnumItem{{Name: "Plastic", Value: 256}},
+			},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		selector string
+		matches  []string
+	}{
+		{"Part", []string{"Car.Wheel", "Car.Body", "Car.Seat.Cushion", "Spare.Wheel"}},
+		{"*", []string{"Car", "Car.Wheel", "Car.Body", "Car.Seat", "Car.Seat.Cushion", "Spare", "Spare.Wheel", "Spare.Drive"}},
+		{"#Wheel", []string{"Car.Wheel", "Spare.Wheel"}},
+		{"#'Car'", []string{"Car"}},
+		{"Model > Part", []string{"Car.Wheel", "Car.Body", "Car.Seat.Cushion"}},
+		{"Model#Car>Part", []string{"Car.Wheel", "Car.Body"}},
+		{"Model#Car Part", []string{"Car.Wheel", "Car.Body", "Car.Seat.Cushion"}},
+		{"Part > Part", nil},
+		{"Folder Part, Script", []string{"Spare.Wheel", "Spare.Drive"}},
+		{"*:IsA(BasePart)", []string{"Car.Wheel", "Car.Body", "Car.Seat.Cushion", "Spare.Wheel"}},
+		{":IsA(Model) > :IsA(BasePart)", []string{"Car.Wheel", "Car.Body", "Car.Seat.Cushion"}},
+		{"Part:not(#Wheel)", []string{"Car.Body", "Car.Seat.Cushion"}},
+		{"Part:not(Model#Car > *)", []string{"Car.Seat.Cushion", "Spare.Wheel"}},
+		{"Part:not( #Wheel , #Body )", []string{"Car.Seat.Cushion"}},
+		{"[Material]", []string{"Car.Wheel"}},
+		{"[Material=Plastic]", []string{"Car.Wheel"}},
+		{"[Material=256]", []string{"Car.Wheel"}},
+		{"[Material=Metal]", nil},
+		{"Part[ Name = Wheel ]", []string{"Car.Wheel", "Spare.Wheel"}},
+		{"Part[Name!=Wheel]", []string{"Car.Body", "Car.Seat.Cushion"}},
+		{"[Name^=Wh]", []string{"Car.Wheel", "Spare.Wheel"}},
+		{"[Name$=t]", []string{"Car.Seat"}},
+		{"[Name*=ee]", []string{"Car.Wheel", "Spare.Wheel"}},
+		{"[Target=Car]", []string{"Car.Body"}},
+		{`[Source='print("hi")']`, []string{"Spare.Drive"}},
+		{`[Source="print(\"hi\")"]`, []string{"Spare.Drive"}},
+	}
+
+	root := testTree()
+	api := testAPI()
+	for _, test := range tests {
+		sel, err := Parse(test.selector)
+		if err != nil {
+			t.Errorf("%s: %s", test.selector, err)
+			continue
+		}
+		var got []string
+		for _, inst := range sel.Select(api, root) {
+			got = append(got, walk.FullName(inst))
+		}
+		if strings.Join(got, " ") != strings.Join(test.matches, " ") {
+			t.Errorf("%s: got %q, want %q", test.selector, got, test.matches)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		selector string
+		offset   int
+	}{
+		{"", 0},
+		{"   ", 3},
+		{"Part[Name", 9},
+		{"Part[Name=Wheel", 15},
+		{"Part[Name='Wheel]", 10},
+		{"Part[=Wheel]", 5},
+		{"Part:not(#Wheel", 15},
+		{":not(", 5},
+		{":IsA(Part", 9},
+		{":unknown(Part)", 9},
+		{"Part#", 5},
+		{"Part >", 6},
+		{"Part,", 5},
+		{"Part)", 4},
+	}
+
+	for _, test := range tests {
+		sel, err := Parse(test.selector)
+		if err == nil {
+			t.Errorf("%q: parsed as %+v", test.selector, sel)
+			continue
+		}
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: got %T, want *SyntaxError", test.selector, err)
+			continue
+		}
+		if serr.Offset != test.offset {
+			t.Errorf("%q: got error at offset %d, want %d: %s", test.selector, serr.Offset, test.offset, serr.Msg)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// Package query selects instances from trees using a selector syntax similar
+// to that of CSS.
+package query
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+)
+
+// Selector is a parsed selector that matches instances.
+type Selector struct {
+	list []complexSelector
+}
+
+type combinator int
+
+const (
+	descendant combinator = iota
+	child
+)
+
+// complexSelector is a sequence of compound selectors, each applying to an
+// instance related to the instance matched by the next.
+type complexSelector []*compound
+
+// compound matches a single instance. comb relates the instance to the
+// instance matched by the previous compound.
+type compound struct {
+	comb  combinator
+	class string
+	preds []predicate
+}
+
+type predicate interface {
+	match(api *rbxapi.API, inst *rbxfile.Instance) bool
+}
+
+// Match returns whether inst is matched by the selector. api is used to
+// resolve class inheritance and enum items, and may be nil.
+func (sel *Selector) Match(api *rbxapi.API, inst *rbxfile.Instance) bool {
+	for _, c := range sel.list {
+		if c.match(api, inst, len(c)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns each instance in root that is matched by the selector, in
+// depth-first order.
+func (sel *Selector) Select(api *rbxapi.API, root *rbxfile.Root) []*rbxfile.Instance {
+	var matches []*rbxfile.Instance
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		if sel.Match(api, inst) {
+			matches = append(matches, inst)
+		}
+		return true
+	})
+	return matches
+}
+
+// match returns whether inst is matched by compound i, and each compound
+// before it is matched by a related instance.
+func (c complexSelector) match(api *rbxapi.API, inst *rbxfile.Instance, i int) bool {
+	if !c[i].match(api, inst) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch c[i].comb {
+	case child:
+		parent := inst.Parent()
+		return parent != nil && c.match(api, parent, i-1)
+	default:
+		for parent := inst.Parent(); parent != nil; parent = parent.Parent() {
+			if c.match(api, parent, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *compound) match(api *rbxapi.API, inst *rbxfile.Instance) bool {
+	if c.class != "" && inst.ClassName != c.class {
+		return false
+	}
+	for _, pred := range c.preds {
+		if !pred.match(api, inst) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsA returns whether a class is equal to, or inherits from, another class,
+// using the Superclass of each class in api. If api is nil, the class must be
+// equal.
+func IsA(api *rbxapi.API, class, super string) bool {
+	if api == nil {
+		return class == super
+	}
+	for i := 0; class != "" && i < len(api.Classes); i++ {
+		if class == super {
+			return true
+		}
+		c := api.Classes[class]
+		if c == nil {
+			break
+		}
+		class = c.Superclass
+	}
+	return class == super
+}
+
+type isA string
+
+func (pred isA) match(api *rbxapi.API, inst *rbxfile.Instance) bool {
+	return IsA(api, inst.ClassName, string(pred))
+}
+
+type not struct {
+	sel *Selector
+}
+
+func (pred not) match(api *rbxapi.API, inst *rbxfile.Instance) bool {
+	return !pred.sel.Match(api, inst)
+}
+
+type property struct {
+	name  string
+	op    string
+	value string
+}
+
+func (pred *property) match(api *rbxapi.API, inst *rbxfile.Instance) bool {
+	value, ok := inst.Properties[pred.name]
+	if !ok {
+		return pred.op == "!="
+	}
+	if pred.op == "" {
+		return true
+	}
+	for _, s := range valueStrings(api, inst.ClassName, pred.name, value) {
+		var ok bool
+		switch pred.op {
+		case "=":
+			ok = s == pred.value
+		case "!=":
+			ok = s == pred.value
+		case "^=":
+			ok = strings.HasPrefix(s, pred.value)
+		case "$=":
+			ok = strings.HasSuffix(s, pred.value)
+		case "*=":
+			ok = strings.Contains(s, pred.value)
+		}
+		if ok {
+			return pred.op != "!="
+		}
+	}
+	return pred.op == "!="
+}
+
+// valueStrings returns the forms of a value that may be compared with a
+// predicate.
+func valueStrings(api *rbxapi.API, class, name string, value rbxfile.Value) []string {
+	switch v := value.(type) {
+	case rbxfile.ValueString:
+		return []string{string(v)}
+	case rbxfile.ValueBinaryString:
+		return []string{string(v)}
+	case rbxfile.ValueProtectedString:
+		return []string{string(v)}
+	case rbxfile.ValueContent:
+		return []string{string(v)}
+	case rbxfile.ValueReference:
+		if v.Instance == nil {
+			return []string{"nil"}
+		}
+		return []string{walk.FullName(v.Instance)}
+	case rbxfile.ValueToken:
+		s := []string{strconv.FormatUint(uint64(v), 10)}
+		if item := enumItem(api, class, name, int(v)); item != nil {
+			s = append(s, item.Name)
+		}
+		return s
+	}
+	return []string{value.String()}
+}
+
+// enumItem returns the enum item of a token value, or nil if the item could
+// not be found.
+func enumItem(api *rbxapi.API, class, name string, value int) *rbxapi.EnumItem {
+	if api == nil {
+		return nil
+	}
+	for i := 0; class != "" && i < len(api.Classes); i++ {
+		c := api.Classes[class]
+		if c == nil {
+			return nil
+		}
+		for _, member := range c.Members {
+			prop, ok := member.(*rbxapi.Property)
+			if !ok || prop.MemberName != name {
+				continue
+			}
+			enum := api.Enums[prop.ValueType]
+			if enum == nil {
+				return nil
+			}
+			for _, item := range enum.Items {
+				if item.Value == value {
+					return item
+				}
+			}
+			return nil
+		}
+		class = c.Superclass
+	}
+	return nil
+}
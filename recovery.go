@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const RecoveryDirName = "recovery"
+
+// recoveryInfoExt is the suffix of the file describing a snapshot. It is
+// distinct from the extension of any snapshot format.
+const recoveryInfoExt = ".recovery.json"
+
+// recoveryInfo describes a recovery snapshot of a session. It is stored next
+// to the snapshot as JSON.
+type recoveryInfo struct {
+	// File is the file the session was originally decoded from. Empty for
+	// new files.
+	File string `json:"file"`
+	// Format is the format of the snapshot, as well as the session.
+	Format string `json:"format"`
+	// Minified is the Minified state of the session.
+	Minified bool `json:"minified"`
+	// Time is when the snapshot was made.
+	Time time.Time `json:"time"`
+
+	id  string
+	dir string
+}
+
+func (r *recoveryInfo) infoFile() string {
+	return filepath.Join(r.dir, r.id+recoveryInfoExt)
+}
+
+func (r *recoveryInfo) snapshotFile() string {
+	return filepath.Join(r.dir, r.id+"."+snapshotFormat(format.FromString(r.Format)).String())
+}
+
+// Remove removes the snapshot and its description.
+func (r *recoveryInfo) Remove() {
+	os.Remove(r.snapshotFile())
+	os.Remove(r.infoFile())
+}
+
+// Restore decodes the snapshot into a new session, which appears as an
+// unsaved session of the original file. The snapshot is removed afterwards.
+func (r *recoveryInfo) Restore() (*Session, error) {
+	s, err := NewSession(r.snapshotFile())
+	if err != nil {
+		return nil, err
+	}
+	s.File = r.File
+	s.Format = format.FromString(r.Format)
+	s.Minified = r.Minified
+	s.markUnsaved()
+	r.Remove()
+	return s, nil
+}
+
+// snapshotFormat returns the format used to store a snapshot of a session in
+// format f. Sessions without a format are stored as XML, which can hold any
+// tree.
+func snapshotFormat(f format.Format) format.Format {
+	if f == format.None {
+		return format.RBXLX
+	}
+	return f
+}
+
+// recoveryID returns an identifier for the snapshots of a session. Sessions of
+// the same file share an identifier, so that newer snapshots replace older
+// ones.
+func recoveryID(s *Session) string {
+	if s.File == "" {
+		return fmt.Sprintf("new-%d-%p", os.Getpid(), s)
+	}
+	file, err := filepath.Abs(s.File)
+	if err != nil {
+		file = s.File
+	}
+	sum := sha1.Sum([]byte(file))
+	return filepath.Base(file) + "-" + hex.EncodeToString(sum[:8])
+}
+
+type autosaveEntry struct {
+	info *recoveryInfo
+	// position is the position of the session's controller when the
+	// snapshot was made.
+	position action.Position
+}
+
+// Autosaver periodically writes snapshots of sessions with unsaved changes to
+// a recovery directory, so that changes can be restored after the program
+// exits unexpectedly.
+type Autosaver struct {
+	dir      string
+	interval time.Duration
+	mutex    sync.Mutex
+	sessions map[*Session]*autosaveEntry
+	stop     chan struct{}
+}
+
+// NewAutosaver returns an Autosaver that writes snapshots to dir every
+// interval. Snapshots are not made if interval is 0.
+func NewAutosaver(dir string, interval time.Duration) *Autosaver {
+	return &Autosaver{
+		dir:      dir,
+		interval: interval,
+		sessions: make(map[*Session]*autosaveEntry, 1),
+	}
+}
+
+// Start begins making snapshots in the background.
+func (a *Autosaver) Start() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.stop != nil || a.interval <= 0 {
+		return
+	}
+	a.stop = make(chan struct{})
+	go func(stop chan struct{}) {
+		t := time.NewTicker(a.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				a.Tick()
+			case <-stop:
+				return
+			}
+		}
+	}(a.stop)
+}
+
+// Stop stops making snapshots. Existing snapshots are left in place.
+func (a *Autosaver) Stop() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.stop != nil {
+		close(a.stop)
+		a.stop = nil
+	}
+}
+
+// Add begins tracking a session.
+func (a *Autosaver) Add(s *Session) {
+	if s == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.sessions[s]; !ok {
+		a.sessions[s] = &autosaveEntry{}
+	}
+}
+
+// Remove stops tracking a session, and removes its snapshot.
+func (a *Autosaver) Remove(s *Session) {
+	if s == nil {
+		return
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if entry, ok := a.sessions[s]; ok {
+		if entry.info != nil {
+			entry.info.Remove()
+		}
+		delete(a.sessions, s)
+	}
+}
+
+// Tick snapshots each session that has changed since its last snapshot, and
+// removes snapshots of sessions that have since been saved.
+func (a *Autosaver) Tick() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for s, entry := range a.sessions {
+		s.Action.Lock()
+		unsaved, position := s.unsaved(), s.Action.Position()
+		s.Action.Unlock()
+
+		switch {
+		case !unsaved:
+			if entry.info != nil {
+				entry.info.Remove()
+				entry.info = nil
+			}
+		case entry.info != nil && entry.position == position:
+			// Mark the snapshot as belonging to a running process.
+			now := time.Now()
+			os.Chtimes(entry.info.infoFile(), now, now)
+		default:
+			info, err := a.snapshot(s)
+			if err != nil {
+				log.Printf("failed to autosave session: %s\n", err)
+				continue
+			}
+			if entry.info != nil && entry.info.id != info.id {
+				entry.info.Remove()
+			}
+			entry.info = info
+			entry.position = position
+		}
+	}
+}
+
+func (a *Autosaver) snapshot(s *Session) (*recoveryInfo, error) {
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s.Action.Lock()
+	defer s.Action.Unlock()
+
+	info := &recoveryInfo{
+		File:     s.File,
+		Format:   s.Format.String(),
+		Minified: s.Minified,
+		Time:     time.Now(),
+		id:       recoveryID(s),
+		dir:      a.dir,
+	}
+	if info.File != "" {
+		if file, err := filepath.Abs(info.File); err == nil {
+			info.File = file
+		}
+	}
+	err := writeFileAtomic(info.snapshotFile(), 0, func(w io.Writer) error {
+		return format.Encode(w, snapshotFormat(s.Format), s.Root, format.Options{API: API, Minified: true})
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeFileAtomic(info.infoFile(), 0, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(info)
+	})
+	if err != nil {
+		os.Remove(info.snapshotFile())
+		return nil, err
+	}
+	return info, nil
+}
+
+// FindOrphans returns snapshots in the recovery directory that are no longer
+// maintained by a running process, ordered from newest to oldest. Snapshots
+// older than the file they were made from are considered stale, and are
+// removed.
+func (a *Autosaver) FindOrphans() []*recoveryInfo {
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		return nil
+	}
+
+	// Running processes refresh their snapshots every interval.
+	threshold := 3 * a.interval
+	if threshold < time.Minute {
+		threshold = time.Minute
+	}
+
+	var orphans []*recoveryInfo
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, recoveryInfoExt) {
+			continue
+		}
+		if time.Since(fi.ModTime()) < threshold {
+			continue
+		}
+		info := &recoveryInfo{
+			id:  strings.TrimSuffix(name, recoveryInfoExt),
+			dir: a.dir,
+		}
+		b, err := ioutil.ReadFile(info.infoFile())
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(b, info); err != nil {
+			log.Printf("invalid recovery file `%s`: %s\n", name, err)
+			continue
+		}
+		if _, err := os.Stat(info.snapshotFile()); err != nil {
+			info.Remove()
+			continue
+		}
+		if info.File != "" {
+			if stat, err := os.Stat(info.File); err == nil && !stat.ModTime().Before(info.Time) {
+				info.Remove()
+				continue
+			}
+		}
+		orphans = append(orphans, info)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Time.After(orphans[j].Time)
+	})
+	return orphans
+}
+
+// FindOrphan returns the orphaned snapshot with the given identifier, or nil
+// if there is no such snapshot.
+func (a *Autosaver) FindOrphan(id string) *recoveryInfo {
+	for _, info := range a.FindOrphans() {
+		if info.id == id {
+			return info
+		}
+	}
+	return nil
+}
+
+// Autosave is used by the GUI to make snapshots of the current session.
+var Autosave *Autosaver
+
+func InitAutosave() {
+	dir, err := getFileNearExec(Settings.Get("recovery_dir").(string), RecoveryDirName)
+	if err != nil {
+		log.Printf("autosave disabled: %s\n", err)
+		return
+	}
+	interval := time.Duration(Settings.Get("autosave_interval").(float64) * float64(time.Second))
+	Autosave = NewAutosaver(dir, interval)
+	Autosave.Start()
+}
+
+// offerRecovery prompts the user to restore each orphaned snapshot in turn.
+// The first restored snapshot is opened in the editor if it has no session.
+// Others are opened in new processes, when enabled.
+func offerRecovery(ctxc *ContextController, editor *EditorContext, orphans []*recoveryInfo) {
+	if len(orphans) == 0 {
+		return
+	}
+	info := orphans[0]
+	next := func() {
+		offerRecovery(ctxc, editor, orphans[1:])
+	}
+
+	name := "a new file"
+	if info.File != "" {
+		name = filepath.Base(info.File)
+	}
+	ctxc.EnterContext(&AlertContext{
+		Title:   "Recover Changes",
+		Text:    "Unsaved changes to " + name + " were recovered from " + info.Time.Format("Jan 2 15:04:05") + ".\nWould you like to restore them?",
+		Buttons: ButtonsYesNoCancel,
+		Finished: func(ok, cancel bool) {
+			switch {
+			case cancel:
+				// Keep the snapshot to be offered again later.
+			case !ok:
+				info.Remove()
+			case editor.session == nil:
+				editor.ChangeSession(info.Restore())
+			case Settings.Get("spawn_processes").(bool):
+				if err := SpawnProcess("--recover", info.id); err != nil {
+					log.Printf("failed to spawn process: %s\n", err)
+				}
+			}
+			next()
+		},
+	})
+}
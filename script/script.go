@@ -0,0 +1,472 @@
+// Package script runs Lua scripts that edit trees of instances.
+//
+// Scripts are provided with an API similar to that of Roblox. The global
+// "game" represents the root of the tree, and each instance is represented
+// by an object that exposes its properties and children:
+//
+//	for _, part in ipairs(game.Workspace:GetDescendants()) do
+//		if part:IsA("BasePart") then
+//			part.Anchored = true
+//		end
+//	end
+//
+// Each change made by a script is performed as an action. The actions of a
+// run are added to the history as one action, so that the run can be undone
+// as a whole.
+//
+// Only the base, table, string, and math libraries are available to scripts,
+// so that a script cannot access files or run programs.
+package script
+
+import (
+	"io"
+
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/anaminus/rbxplore/query"
+	"github.com/anaminus/rbxplore/validate"
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+	"github.com/yuin/gopher-lua"
+)
+
+const (
+	typeGame     = "DataModel"
+	typeInstance = "Instance"
+	typeValue    = "Value"
+)
+
+// Runner runs scripts against a tree of instances.
+type Runner struct {
+	Root   *rbxfile.Root
+	Action *action.Controller
+	// API is used to resolve class inheritance and property types. It may
+	// be nil.
+	API *rbxapi.API
+
+	state *lua.LState
+	game  *lua.LUserData
+	// Actions performed by the current run.
+	actions action.Group
+	// Objects for each instance, so that instances can be compared.
+	objects map[*rbxfile.Instance]*lua.LUserData
+}
+
+// NewRunner returns a Runner that modifies root, performing each change
+// with ac.
+func NewRunner(root *rbxfile.Root, ac *action.Controller, api *rbxapi.API) *Runner {
+	r := &Runner{
+		Root:    root,
+		Action:  ac,
+		API:     api,
+		state:   newState(),
+		objects: map[*rbxfile.Instance]*lua.LUserData{},
+	}
+	L := r.state
+
+	mt := L.NewTypeMetatable(typeGame)
+	L.SetField(mt, "__index", L.NewFunction(r.gameIndex))
+	L.SetField(mt, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString("game"))
+		return 1
+	}))
+	r.game = L.NewUserData()
+	r.game.Value = root
+	r.game.Metatable = mt
+	L.SetGlobal("game", r.game)
+
+	mt = L.NewTypeMetatable(typeInstance)
+	L.SetField(mt, "__index", L.NewFunction(r.instanceIndex))
+	L.SetField(mt, "__newindex", L.NewFunction(r.instanceNewIndex))
+	L.SetField(mt, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(checkInstance(L, 1).Name()))
+		return 1
+	}))
+
+	instanceLib := L.NewTable()
+	L.SetField(instanceLib, "new", L.NewFunction(r.instanceNew))
+	L.SetGlobal("Instance", instanceLib)
+
+	r.openValues()
+	return r
+}
+
+// newState returns a Lua state with only the libraries that cannot affect
+// anything outside of the state.
+func newState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// The base library can read files.
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+	return L
+}
+
+// Close releases the resources of the runner.
+func (r *Runner) Close() {
+	r.state.Close()
+}
+
+// Run runs a script read from src. name is used to identify the script in
+// error messages, and in the description of the run. The changes made by the
+// script are added to the history as one action labeled "Run <name>", even
+// if the script fails partway.
+func (r *Runner) Run(name string, src io.Reader) error {
+	fn, err := r.state.Load(src, name)
+	if err != nil {
+		return err
+	}
+	r.actions = nil
+	r.state.Push(fn)
+	err = r.state.PCall(0, 0, nil)
+	if len(r.actions) > 0 {
+		r.Action.Record(action.Labeled{Action: r.actions, Label: "Run " + name})
+		r.actions = nil
+	}
+	return err
+}
+
+// object returns the Lua object for an instance.
+func (r *Runner) object(inst *rbxfile.Instance) lua.LValue {
+	if inst == nil {
+		return lua.LNil
+	}
+	if ud, ok := r.objects[inst]; ok {
+		return ud
+	}
+	ud := r.state.NewUserData()
+	ud.Value = inst
+	ud.Metatable = r.state.GetTypeMetatable(typeInstance)
+	r.objects[inst] = ud
+	return ud
+}
+
+func checkInstance(L *lua.LState, n int) *rbxfile.Instance {
+	ud := L.CheckUserData(n)
+	if inst, ok := ud.Value.(*rbxfile.Instance); ok {
+		return inst
+	}
+	L.ArgError(n, "Instance expected")
+	return nil
+}
+
+// isTop returns the index of inst within the top-level instances of the
+// root, or -1 if inst is not a top-level instance.
+func (r *Runner) isTop(inst *rbxfile.Instance) int {
+	for i, top := range r.Root.Instances {
+		if top == inst {
+			return i
+		}
+	}
+	return -1
+}
+
+// do performs an action, raising an error if it fails. The action is added
+// to the actions of the current run.
+func (r *Runner) do(L *lua.LState, a action.Action) {
+	r.Action.Lock()
+	err := a.Setup()
+	if err == nil {
+		err = a.Forward()
+	}
+	r.Action.Unlock()
+	if err != nil {
+		L.RaiseError("%s", err)
+	}
+	r.actions = append(r.actions, a)
+}
+
+// setParent moves inst to parent, which is either an instance, game, or nil.
+func (r *Runner) setParent(L *lua.LState, inst *rbxfile.Instance, parent lua.LValue) {
+	var group action.Group
+	if i := r.isTop(inst); i >= 0 {
+		group = append(group, cmd.RemoveRootInstance(r.Root, i))
+	} else if inst.Parent() != nil {
+		group = append(group, cmd.SetParent(inst, nil))
+	}
+	switch parent := parent.(type) {
+	case *lua.LNilType:
+	case *lua.LUserData:
+		switch p := parent.Value.(type) {
+		case *rbxfile.Root:
+			group = append(group, cmd.AddRootInstance(r.Root, inst))
+		case *rbxfile.Instance:
+			if p == inst || p.IsDescendantOf(inst) {
+				L.RaiseError("attempt to set parent of %s to a descendant of itself", inst.Name())
+			}
+			group = append(group, cmd.SetParent(inst, p))
+		default:
+			L.RaiseError("Instance expected for Parent")
+		}
+	default:
+		L.RaiseError("Instance expected for Parent, got %s", parent.Type())
+	}
+	if len(group) == 0 {
+		return
+	}
+	r.do(L, group)
+}
+
+// children returns a table containing a list of instances.
+func (r *Runner) children(list []*rbxfile.Instance) *lua.LTable {
+	t := r.state.CreateTable(len(list), 0)
+	for _, inst := range list {
+		t.Append(r.object(inst))
+	}
+	return t
+}
+
+// descendants returns a table containing the descendants of each instance
+// in a list.
+func (r *Runner) descendants(list []*rbxfile.Instance) *lua.LTable {
+	t := r.state.NewTable()
+	var add func(list []*rbxfile.Instance)
+	add = func(list []*rbxfile.Instance) {
+		for _, inst := range list {
+			t.Append(r.object(inst))
+			add(inst.Children)
+		}
+	}
+	add(list)
+	return t
+}
+
+// findFirstChild returns the first instance in list with the given name, or
+// nil. If recursive is true, then descendants are searched.
+func findFirstChild(list []*rbxfile.Instance, name string, recursive bool) *rbxfile.Instance {
+	for _, inst := range list {
+		if inst.Name() == name {
+			return inst
+		}
+	}
+	if recursive {
+		for _, inst := range list {
+			if d := findFirstChild(inst.Children, name, true); d != nil {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+////////////////
+
+func (r *Runner) gameIndex(L *lua.LState) int {
+	key := L.CheckString(2)
+	switch key {
+	case "ClassName", "Name":
+		L.Push(lua.LString(typeGame))
+	case "GetChildren":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			L.Push(r.children(r.Root.Instances))
+			return 1
+		}))
+	case "GetDescendants":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			L.Push(r.descendants(r.Root.Instances))
+			return 1
+		}))
+	case "FindFirstChild":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			L.Push(r.object(findFirstChild(r.Root.Instances, L.CheckString(2), L.OptBool(3, false))))
+			return 1
+		}))
+	case "GetService":
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			class := L.CheckString(2)
+			for _, inst := range r.Root.Instances {
+				if inst.ClassName == class {
+					L.Push(r.object(inst))
+					return 1
+				}
+			}
+			L.RaiseError("'%s' is not a service in this file", class)
+			return 0
+		}))
+	default:
+		inst := findFirstChild(r.Root.Instances, key, false)
+		if inst == nil {
+			L.RaiseError("%s is not a valid member of %s", key, typeGame)
+		}
+		L.Push(r.object(inst))
+	}
+	return 1
+}
+
+////////////////
+
+func (r *Runner) instanceNew(L *lua.LState) int {
+	inst := rbxfile.NewInstance(L.CheckString(1), nil)
+	inst.SetName(inst.ClassName)
+	if L.GetTop() >= 2 && L.Get(2) != lua.LNil {
+		r.setParent(L, inst, L.Get(2))
+	}
+	L.Push(r.object(inst))
+	return 1
+}
+
+// methods of instances. The instance is the first argument.
+var methods = map[string]func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int{
+	"FindFirstChild": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(r.object(findFirstChild(inst.Children, L.CheckString(2), L.OptBool(3, false))))
+		return 1
+	},
+	"FindFirstChildOfClass": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		class := L.CheckString(2)
+		for _, child := range inst.Children {
+			if child.ClassName == class {
+				L.Push(r.object(child))
+				return 1
+			}
+		}
+		L.Push(lua.LNil)
+		return 1
+	},
+	"GetChildren": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(r.children(inst.Children))
+		return 1
+	},
+	"GetDescendants": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(r.descendants(inst.Children))
+		return 1
+	},
+	"GetFullName": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(lua.LString(inst.GetFullName()))
+		return 1
+	},
+	"IsA": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(lua.LBool(query.IsA(r.API, inst.ClassName, L.CheckString(2))))
+		return 1
+	},
+	"IsDescendantOf": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(lua.LBool(inst.IsDescendantOf(checkInstance(L, 2))))
+		return 1
+	},
+	"Clone": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		L.Push(r.object(inst.Clone()))
+		return 1
+	},
+	"Destroy": func(r *Runner, L *lua.LState, inst *rbxfile.Instance) int {
+		r.setParent(L, inst, lua.LNil)
+		return 0
+	},
+}
+
+func (r *Runner) instanceIndex(L *lua.LState) int {
+	inst := checkInstance(L, 1)
+	key := L.CheckString(2)
+	if method, ok := methods[key]; ok {
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			return method(r, L, checkInstance(L, 1))
+		}))
+		return 1
+	}
+	switch key {
+	case "ClassName":
+		L.Push(lua.LString(inst.ClassName))
+		return 1
+	case "Parent":
+		if parent := inst.Parent(); parent != nil {
+			L.Push(r.object(parent))
+		} else if r.isTop(inst) >= 0 {
+			L.Push(r.game)
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 1
+	}
+	if value, ok := inst.Properties[key]; ok {
+		L.Push(r.toLua(value))
+		return 1
+	}
+	if child := findFirstChild(inst.Children, key, false); child != nil {
+		L.Push(r.object(child))
+		return 1
+	}
+	L.RaiseError("%s is not a valid member of %s", key, inst.ClassName)
+	return 0
+}
+
+func (r *Runner) instanceNewIndex(L *lua.LState) int {
+	inst := checkInstance(L, 1)
+	key := L.CheckString(2)
+	lv := L.CheckAny(3)
+	switch key {
+	case "Parent":
+		r.setParent(L, inst, lv)
+		return 0
+	case "ClassName":
+		r.do(L, cmd.SetClassName(inst, L.CheckString(3)))
+		return 0
+	}
+	if _, ok := methods[key]; ok {
+		L.RaiseError("%s cannot be assigned to", key)
+	}
+	value, err := r.fromLua(lv, r.propertyType(inst, key), r.enum(inst.ClassName, key))
+	if err != nil {
+		L.RaiseError("bad value for %s.%s: %s", inst.ClassName, key, err)
+	}
+	r.do(L, cmd.SetProperty(inst, key, value))
+	return 0
+}
+
+////////////////
+
+// member returns the API descriptor of a property, or nil if it could not
+// be found.
+func (r *Runner) member(class, name string) *rbxapi.Property {
+	if r.API == nil {
+		return nil
+	}
+	for i := 0; class != "" && i < len(r.API.Classes); i++ {
+		c := r.API.Classes[class]
+		if c == nil {
+			return nil
+		}
+		for _, member := range c.Members {
+			if prop, ok := member.(*rbxapi.Property); ok && prop.MemberName == name {
+				return prop
+			}
+		}
+		class = c.Superclass
+	}
+	return nil
+}
+
+// propertyType returns the type of a property. The type of an existing value
+// is used, then the type according to the API. TypeInvalid is returned if
+// the type could not be determined.
+func (r *Runner) propertyType(inst *rbxfile.Instance, name string) rbxfile.Type {
+	if value, ok := inst.Properties[name]; ok {
+		return value.Type()
+	}
+	prop := r.member(inst.ClassName, name)
+	if prop == nil {
+		return rbxfile.TypeInvalid
+	}
+	if r.API.Enums[prop.ValueType] != nil {
+		return rbxfile.TypeToken
+	}
+	return validate.ValueType(prop.ValueType)
+}
+
+// enum returns the enum of a property, or nil if the property is not known
+// to be an enum.
+func (r *Runner) enum(class, name string) *rbxapi.Enum {
+	if prop := r.member(class, name); prop != nil {
+		return r.API.Enums[prop.ValueType]
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package script
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+	"github.com/yuin/gopher-lua"
+)
+
+// openValues creates the metatable of values, and a constructor for each
+// type of value that has components.
+func (r *Runner) openValues() {
+	L := r.state
+
+	mt := L.NewTypeMetatable(typeValue)
+	L.SetField(mt, "__index", L.NewFunction(r.valueIndex))
+	L.SetField(mt, "__tostring", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString(checkValue(L, 1).String()))
+		return 1
+	}))
+	L.SetField(mt, "__eq", L.NewFunction(func(L *lua.LState) int {
+		a, b := checkValue(L, 1), checkValue(L, 2)
+		L.Push(lua.LBool(a.Type() == b.Type() && a.String() == b.String()))
+		return 1
+	}))
+
+	constructors := map[string]lua.LGFunction{
+		"UDim": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueUDim{
+				Scale:  float32(L.OptNumber(1, 0)),
+				Offset: int16(L.OptNumber(2, 0)),
+			})
+		},
+		"UDim2": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueUDim2{
+				X: rbxfile.ValueUDim{Scale: float32(L.OptNumber(1, 0)), Offset: int16(L.OptNumber(2, 0))},
+				Y: rbxfile.ValueUDim{Scale: float32(L.OptNumber(3, 0)), Offset: int16(L.OptNumber(4, 0))},
+			})
+		},
+		"Color3": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueColor3{
+				R: float32(L.OptNumber(1, 0)),
+				G: float32(L.OptNumber(2, 0)),
+				B: float32(L.OptNumber(3, 0)),
+			})
+		},
+		"Vector2": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueVector2{
+				X: float32(L.OptNumber(1, 0)),
+				Y: float32(L.OptNumber(2, 0)),
+			})
+		},
+		"Vector3": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueVector3{
+				X: float32(L.OptNumber(1, 0)),
+				Y: float32(L.OptNumber(2, 0)),
+				Z: float32(L.OptNumber(3, 0)),
+			})
+		},
+		"CFrame": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueCFrame{
+				Position: rbxfile.ValueVector3{
+					X: float32(L.OptNumber(1, 0)),
+					Y: float32(L.OptNumber(2, 0)),
+					Z: float32(L.OptNumber(3, 0)),
+				},
+				Rotation: [9]float32{1, 0, 0, 0, 1, 0, 0, 0, 1},
+			})
+		},
+		"Vector2int16": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueVector2int16{
+				X: int16(L.OptNumber(1, 0)),
+				Y: int16(L.OptNumber(2, 0)),
+			})
+		},
+		"Vector3int16": func(L *lua.LState) int {
+			return r.pushValue(L, rbxfile.ValueVector3int16{
+				X: int16(L.OptNumber(1, 0)),
+				Y: int16(L.OptNumber(2, 0)),
+				Z: int16(L.OptNumber(3, 0)),
+			})
+		},
+		"NumberRange": func(L *lua.LState) int {
+			min := float32(L.CheckNumber(1))
+			return r.pushValue(L, rbxfile.ValueNumberRange{
+				Min: min,
+				Max: float32(L.OptNumber(2, lua.LNumber(min))),
+			})
+		},
+	}
+	for name, fn := range constructors {
+		lib := L.NewTable()
+		L.SetField(lib, "new", L.NewFunction(fn))
+		L.SetGlobal(name, lib)
+	}
+}
+
+func checkValue(L *lua.LState, n int) rbxfile.Value {
+	ud := L.CheckUserData(n)
+	if v, ok := ud.Value.(rbxfile.Value); ok {
+		return v
+	}
+	L.ArgError(n, "value expected")
+	return nil
+}
+
+func (r *Runner) pushValue(L *lua.LState, v rbxfile.Value) int {
+	ud := L.NewUserData()
+	ud.Value = v
+	ud.Metatable = L.GetTypeMetatable(typeValue)
+	L.Push(ud)
+	return 1
+}
+
+// valueIndex gets a component of a value by the name of its field.
+func (r *Runner) valueIndex(L *lua.LState) int {
+	v := checkValue(L, 1)
+	key := L.CheckString(2)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Struct {
+		if field := rv.FieldByName(key); field.IsValid() {
+			L.Push(r.component(L, field))
+			return 1
+		}
+	}
+	L.RaiseError("%s is not a valid member of %s", key, v.Type())
+	return 0
+}
+
+// component converts a field of a value to a Lua value.
+func (r *Runner) component(L *lua.LState, field reflect.Value) lua.LValue {
+	if v, ok := field.Interface().(rbxfile.Value); ok {
+		return r.toLua(v)
+	}
+	switch field.Kind() {
+	case reflect.Bool:
+		return lua.LBool(field.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return lua.LNumber(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(field.Float())
+	case reflect.Array, reflect.Slice:
+		t := L.CreateTable(field.Len(), 0)
+		for i := 0; i < field.Len(); i++ {
+			t.Append(r.component(L, field.Index(i)))
+		}
+		return t
+	}
+	return lua.LString(fmt.Sprint(field.Interface()))
+}
+
+// toLua converts a property value to a Lua value. Strings, bools, and
+// numbers are converted to the corresponding Lua type, references are
+// converted to instances, and other values are converted to userdata.
+func (r *Runner) toLua(value rbxfile.Value) lua.LValue {
+	switch v := value.(type) {
+	case rbxfile.ValueString:
+		return lua.LString(v)
+	case rbxfile.ValueBinaryString:
+		return lua.LString(v)
+	case rbxfile.ValueProtectedString:
+		return lua.LString(v)
+	case rbxfile.ValueContent:
+		return lua.LString(v)
+	case rbxfile.ValueBool:
+		return lua.LBool(v)
+	case rbxfile.ValueInt:
+		return lua.LNumber(v)
+	case rbxfile.ValueFloat:
+		return lua.LNumber(v)
+	case rbxfile.ValueDouble:
+		return lua.LNumber(v)
+	case rbxfile.ValueBrickColor:
+		return lua.LNumber(v)
+	case rbxfile.ValueToken:
+		return lua.LNumber(v)
+	case rbxfile.ValueReference:
+		return r.object(v.Instance)
+	}
+	ud := r.state.NewUserData()
+	ud.Value = value
+	ud.Metatable = r.state.GetTypeMetatable(typeValue)
+	return ud
+}
+
+// inferType returns the property type that corresponds to a Lua value.
+func inferType(lv lua.LValue) rbxfile.Type {
+	switch lv := lv.(type) {
+	case lua.LString:
+		return rbxfile.TypeString
+	case lua.LBool:
+		return rbxfile.TypeBool
+	case lua.LNumber:
+		return rbxfile.TypeDouble
+	case *lua.LUserData:
+		switch v := lv.Value.(type) {
+		case *rbxfile.Instance:
+			return rbxfile.TypeReference
+		case rbxfile.Value:
+			return v.Type()
+		}
+	}
+	return rbxfile.TypeInvalid
+}
+
+// fromLua converts a Lua value to a property value of type typ. If typ is
+// TypeInvalid, then the type is inferred from the Lua value. Tokens may be
+// given as the name of an item of enum, if enum is not nil.
+func (r *Runner) fromLua(lv lua.LValue, typ rbxfile.Type, enum *rbxapi.Enum) (rbxfile.Value, error) {
+	if typ == rbxfile.TypeInvalid {
+		if typ = inferType(lv); typ == rbxfile.TypeInvalid {
+			return nil, fmt.Errorf("cannot convert %s to a value", lv.Type())
+		}
+	}
+	mismatch := func() (rbxfile.Value, error) {
+		return nil, fmt.Errorf("%s expected, got %s", typ, lv.Type())
+	}
+
+	switch typ {
+	case rbxfile.TypeString, rbxfile.TypeBinaryString, rbxfile.TypeProtectedString, rbxfile.TypeContent:
+		s, ok := lv.(lua.LString)
+		if !ok {
+			return mismatch()
+		}
+		switch typ {
+		case rbxfile.TypeString:
+			return rbxfile.ValueString(s), nil
+		case rbxfile.TypeBinaryString:
+			return rbxfile.ValueBinaryString(s), nil
+		case rbxfile.TypeProtectedString:
+			return rbxfile.ValueProtectedString(s), nil
+		default:
+			return rbxfile.ValueContent(s), nil
+		}
+	case rbxfile.TypeBool:
+		b, ok := lv.(lua.LBool)
+		if !ok {
+			return mismatch()
+		}
+		return rbxfile.ValueBool(b), nil
+	case rbxfile.TypeToken:
+		if s, ok := lv.(lua.LString); ok && enum != nil {
+			for _, item := range enum.Items {
+				if item.Name == string(s) {
+					return rbxfile.ValueToken(item.Value), nil
+				}
+			}
+			return nil, fmt.Errorf("%q is not a valid item of enum %s", s, enum.Name)
+		}
+		fallthrough
+	case rbxfile.TypeInt, rbxfile.TypeFloat, rbxfile.TypeDouble, rbxfile.TypeBrickColor:
+		n, ok := lv.(lua.LNumber)
+		if !ok {
+			return mismatch()
+		}
+		switch typ {
+		case rbxfile.TypeInt:
+			return rbxfile.ValueInt(n), nil
+		case rbxfile.TypeFloat:
+			return rbxfile.ValueFloat(n), nil
+		case rbxfile.TypeDouble:
+			return rbxfile.ValueDouble(n), nil
+		case rbxfile.TypeBrickColor:
+			return rbxfile.ValueBrickColor(n), nil
+		default:
+			return rbxfile.ValueToken(n), nil
+		}
+	case rbxfile.TypeReference:
+		if lv == lua.LNil {
+			return rbxfile.ValueReference{}, nil
+		}
+		if ud, ok := lv.(*lua.LUserData); ok {
+			if inst, ok := ud.Value.(*rbxfile.Instance); ok {
+				return rbxfile.ValueReference{Instance: inst}, nil
+			}
+		}
+		return mismatch()
+	}
+
+	if ud, ok := lv.(*lua.LUserData); ok {
+		if v, ok := ud.Value.(rbxfile.Value); ok && v.Type() == typ {
+			return v.Copy(), nil
+		}
+	}
+	return mismatch()
+}
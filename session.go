@@ -1,84 +1,39 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"crypto/sha1"
 	"errors"
 	"github.com/anaminus/gxui"
 	"github.com/anaminus/gxui/math"
 	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/format"
 	"io"
+	"log"
 	"os"
-	"path/filepath"
-	"strings"
 
-	"github.com/robloxapi/rbxapi"
 	"github.com/robloxapi/rbxfile"
-	"github.com/robloxapi/rbxfile/bin"
-	"github.com/robloxapi/rbxfile/xml"
 )
 
-type Format byte
-
-const (
-	FormatNone Format = iota
-	FormatRBXL
-	FormatRBXM
-	FormatRBXLX
-	FormatRBXMX
-	FormatJSON
-)
-
-func (f Format) String() string {
-	switch f {
-	case FormatRBXL:
-		return "rbxl"
-	case FormatRBXM:
-		return "rbxm"
-	case FormatRBXLX:
-		return "rbxlx"
-	case FormatRBXMX:
-		return "rbxmx"
-	case FormatJSON:
-		return "json"
-	}
-	return ""
-}
-
-func FormatFromString(s string) Format {
-	switch strings.ToLower(s) {
-	case "rbxl":
-		return FormatRBXL
-	case "rbxm":
-		return FormatRBXM
-	case "rbxlx":
-		return FormatRBXLX
-	case "rbxmx":
-		return FormatRBXMX
-	case "json":
-		return FormatJSON
-	}
-	return FormatNone
-}
-
 type FormatAdapter struct {
 	gxui.AdapterBase
 }
 
 func (a FormatAdapter) Count() int {
-	return 6
+	return format.Count
 }
 
 func (a FormatAdapter) ItemAt(index int) gxui.AdapterItem {
-	return Format(index)
+	return format.Format(index)
 }
 
 func (a FormatAdapter) ItemIndex(item gxui.AdapterItem) int {
-	return int(item.(Format))
+	return int(item.(format.Format))
 }
 
 func (a FormatAdapter) Create(theme gxui.Theme, index int) gxui.Control {
 	l := theme.CreateLabel()
-	text := Format(index).String()
+	text := format.Format(index).String()
 	if text == "" {
 		text = "None"
 	}
@@ -92,25 +47,52 @@ func (a FormatAdapter) Size(gxui.Theme) math.Size {
 
 type Session struct {
 	File     string
-	Format   Format
+	Format   format.Format
 	Minified bool
 	Root     *rbxfile.Root
 	Action   *action.Controller
-	Unsaved  bool
+
+	// Backups is the number of previous versions of File to keep when
+	// encoding.
+	Backups int
+
+	// History is whether the history of Action is written to a journal next
+	// to File when encoding, and restored when decoding.
+	History bool
+
+	// Warnings contains problems that did not prevent the file from being
+	// decoded.
+	Warnings []error
+
+	// saved is the position of Action when the session was last saved.
+	saved action.Position
 }
 
+// defaultHistorySize is the number of actions kept in the history of a
+// session when there are no settings.
+const defaultHistorySize = 100
+
 func NewSession(file string) (*Session, error) {
 	s := &Session{
-		File:   file,
-		Root:   &rbxfile.Root{},
-		Action: action.CreateController(20),
+		File: file,
+		Root: &rbxfile.Root{},
 	}
-	s.Action.OnUpdate(func(...interface{}) {
-		s.Unsaved = true
-	})
+	historySize := defaultHistorySize
+	if Settings != nil {
+		s.Backups = int(Settings.Get("backup_count").(float64))
+		s.History = Settings.Get("save_history").(bool)
+		historySize = int(Settings.Get("history_size").(float64))
+	}
+	s.Action = action.CreateController(historySize)
+	s.saved = s.Action.Position()
 	if err := s.decodeFile(); err != nil {
 		return nil, err
 	}
+	if s.History && s.File != "" {
+		if err := s.readJournal(); err != nil {
+			log.Printf("could not restore history of `%s`: %s\n", s.File, err)
+		}
+	}
 	return s, nil
 }
 
@@ -129,34 +111,38 @@ func (s *Session) decodeFile() error {
 	}
 	defer f.Close()
 
-	var decode func(io.Reader, *rbxapi.API) (*rbxfile.Root, error)
+	return s.decode(f)
+}
+
+// Decode decodes the content of r into Root. The format is determined from
+// the content, falling back to Format if the content is not recognized.
+func (s *Session) Decode(r io.Reader) error {
+	s.Action.Lock()
+	defer s.Action.Unlock()
+
+	return s.decode(r)
+}
+
+func (s *Session) decode(in io.Reader) error {
+	r := bufio.NewReaderSize(in, format.SniffLength)
+	head, _ := r.Peek(format.SniffLength)
 
-	// Guess format from file extension.
-	if format := FormatFromString(filepath.Ext(f.Name())[1:]); format != FormatNone {
-		s.Format = format
+	// Determine the format from the content, using the file extension or the
+	// given format to choose between place and model variants.
+	f, guessed, warning := format.Detect(head, s.File, s.Format)
+	if warning != nil {
+		s.Warnings = append(s.Warnings, warning)
 	}
-	// Otherwise, use given format.
-	switch s.Format {
-	case FormatRBXL:
-		decode = bin.DeserializePlace
-	case FormatRBXM:
-		decode = bin.DeserializeModel
-	case FormatRBXLX:
-		decode = xml.Deserialize
-	case FormatRBXMX:
-		decode = xml.Deserialize
-	case FormatJSON:
-		d := json.NewDecoder(f)
-		if err := d.Decode(s.Root); err != nil {
-			return err
-		}
-		return nil
-	default:
-		return errors.New("unknown format")
+	root, err := format.Decode(r, f, API)
+	if err != nil {
+		return err
 	}
-
-	s.Root, err = decode(f, API)
-	return err
+	if guessed {
+		f = format.Refine(f, root)
+	}
+	s.Root = root
+	s.Format = f
+	return nil
 }
 
 func (s *Session) EncodeFile() error {
@@ -166,40 +152,59 @@ func (s *Session) EncodeFile() error {
 	if s.File == "" {
 		return errors.New("no file")
 	}
-	if s.Format == FormatNone {
+	if s.Format == format.None {
 		return errors.New("no format")
 	}
 
-	f, err := os.Create(s.File)
+	hash := sha1.New()
+	err := writeFileAtomic(s.File, s.Backups, func(w io.Writer) error {
+		return format.Encode(io.MultiWriter(w, hash), s.Format, s.Root, s.options())
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	var encode func(io.Writer, *rbxapi.API, *rbxfile.Root) error
-	switch s.Format {
-	case FormatRBXL:
-		encode = bin.SerializePlace
-	case FormatRBXM:
-		encode = bin.SerializeModel
-	case FormatRBXLX:
-		encode = xml.Serialize
-	case FormatRBXMX:
-		encode = xml.Serialize
-	case FormatJSON:
-		e := json.NewEncoder(f)
-		if err := e.Encode(s.Root); err != nil {
-			return err
+	s.saved = s.Action.Position()
+	if s.History {
+		if err := s.writeJournal(hash.Sum(nil)); err != nil {
+			log.Printf("could not write history of `%s`: %s\n", s.File, err)
 		}
-		return nil
-	default:
-		return errors.New("unknown format")
 	}
+	return nil
+}
 
-	err = encode(f, API, s.Root)
-	if err != nil {
-		return err
+// Unsaved returns whether Root has changed since the session was last saved.
+// Undoing changes back to the saved state makes the session saved again.
+func (s *Session) Unsaved() bool {
+	s.Action.Lock()
+	defer s.Action.Unlock()
+
+	return s.unsaved()
+}
+
+func (s *Session) unsaved() bool {
+	return s.Action.Position() != s.saved
+}
+
+// markUnsaved causes the session to be unsaved until it is saved again.
+func (s *Session) markUnsaved() {
+	s.Action.Lock()
+	defer s.Action.Unlock()
+
+	s.saved = action.NoPosition
+}
+
+// Encode encodes Root to w in Format. Unlike EncodeFile, the session is not
+// considered to be saved.
+func (s *Session) Encode(w io.Writer) error {
+	s.Action.Lock()
+	defer s.Action.Unlock()
+
+	if s.Format == format.None {
+		return errors.New("no format")
 	}
-	s.Unsaved = false
-	return nil
+	return format.Encode(w, s.Format, s.Root, s.options())
+}
+
+func (s *Session) options() format.Options {
+	return format.Options{API: API, Minified: s.Minified}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/anaminus/gxui"
 	"github.com/anaminus/gxui/math"
+	"strconv"
 )
 
 type SettingsContext struct {
@@ -146,6 +147,50 @@ func (c *SettingsContext) Entering(ctxc *ContextController) ([]gxui.Control, boo
 		layout.AddChild(group("Update URLs", table))
 	}
 
+	// Saving
+	{
+		rows := []struct {
+			name, setting string
+			number        bool
+		}{
+			{"Backups to keep", "backup_count", true},
+			{"Autosave interval (seconds)", "autosave_interval", true},
+			{"Recovery folder", "recovery_dir", false},
+			{"Actions to keep in history", "history_size", true},
+		}
+
+		table := theme.CreateTableLayout()
+		table.SetGrid(2, len(rows))
+		table.SetDesiredSize(math.Size{-1, 32 * len(rows)})
+		table.SetSizeClamped(true, true)
+		table.SetColumnWeight(1, 3)
+		for i, row := range rows {
+			setting := row.setting
+			label := theme.CreateLabel()
+			label.SetText(row.name)
+			table.SetChildAt(0, i, 1, 1, label)
+
+			textbox := theme.CreateTextBox()
+			if row.number {
+				textbox.SetDesiredWidth(60)
+				textbox.SetText(strconv.Itoa(int(c.settings[setting].(float64))))
+				textbox.OnTextChanged(func([]gxui.TextBoxEdit) {
+					if n, err := strconv.Atoi(textbox.Text()); err == nil && n >= 0 {
+						c.settings[setting] = float64(n)
+					}
+				})
+			} else {
+				textbox.SetDesiredWidth(math.MaxSize.W)
+				textbox.SetText(c.settings[setting].(string))
+				textbox.OnTextChanged(func([]gxui.TextBoxEdit) {
+					c.settings[setting] = textbox.Text()
+				})
+			}
+			table.SetChildAt(1, i, 1, 1, textbox)
+		}
+		layout.AddChild(group("Saving", table))
+	}
+
 	actions := theme.CreateLinearLayout()
 	actions.SetDirection(gxui.LeftToRight)
 	actions.SetHorizontalAlignment(gxui.AlignRight)
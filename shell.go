@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// ShellCommand is a command that runs in shell mode when its name is given
+// as the first argument.
+type ShellCommand struct {
+	// Name is used to select the command.
+	Name string
+	// Args summarizes the arguments of the command.
+	Args string
+	// Summary briefly describes the command.
+	Summary string
+	// Flags defines the flags of the command, if any.
+	Flags func(flags *flag.FlagSet)
+	// Run runs the command with the remaining arguments, returning the exit
+	// code of the program.
+	Run func(args []string) int
+}
+
+// ShellCommands contains each command available in shell mode.
+var ShellCommands map[string]*ShellCommand
+
+func InitShellCommands() {
+	ShellCommands = map[string]*ShellCommand{}
+	for _, cmd := range []*ShellCommand{
+		diffCommand,
+		textconvCommand,
+		mergeDriverCommand,
+		queryCommand,
+		runCommand,
+		treeCommand,
+		statsCommand,
+		validateCommand,
+		refsCommand,
+		extractScriptsCommand,
+		injectScriptsCommand,
+		unpackCommand,
+		packCommand,
+	} {
+		ShellCommands[cmd.Name] = cmd
+	}
+}
+
+// findShellCommand returns the command named by the first argument. A file
+// of the same name takes precedence, so that it can still be converted.
+func findShellCommand(args []string) *ShellCommand {
+	if len(args) == 0 {
+		return nil
+	}
+	cmd := ShellCommands[args[0]]
+	if cmd == nil {
+		return nil
+	}
+	if _, err := os.Stat(args[0]); err == nil {
+		return nil
+	}
+	return cmd
+}
+
+// runShellCommand parses the flags of a command, then runs it.
+func runShellCommand(cmd *ShellCommand, args []string) int {
+	flags := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s --shell %s [options] %s\n\n%s\n\n", os.Args[0], cmd.Name, cmd.Args, cmd.Summary)
+		flags.PrintDefaults()
+	}
+	if cmd.Flags != nil {
+		cmd.Flags(flags)
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	return cmd.Run(flags.Args())
+}
+
+// printShellCommands writes a summary of each command.
+func printShellCommands() {
+	names := make([]string, 0, len(ShellCommands))
+	for name := range ShellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Commands available with --shell:\n\n")
+	for _, name := range names {
+		cmd := ShellCommands[name]
+		fmt.Fprintf(os.Stderr, "  %s %s\n    \t%s\n", cmd.Name, cmd.Args, cmd.Summary)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// openSession decodes a file into a new session, reading from standard
+// input if the file is StdStream. Warnings are written to standard error.
+func openSession(file string) (*Session, error) {
+	var session *Session
+	var err error
+	if file == StdStream {
+		session, _ = NewSession("")
+		err = session.Decode(os.Stdin)
+	} else {
+		session, err = NewSession(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range session.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	return session, nil
+}
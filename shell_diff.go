@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/diff"
+	"io"
+	"os"
+)
+
+var diffOption struct {
+	JSON bool
+}
+
+var diffCommand = &ShellCommand{
+	Name:    "diff",
+	Args:    "<file-a> <file-b>",
+	Summary: "Compare the instances and properties of two files. Exits with 1 if the files differ.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&diffOption.JSON, "json", false, "Output differences as JSON.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "diff requires two files")
+			return 2
+		}
+		a, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+		b, err := openSession(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[1], err)
+			return 2
+		}
+
+		result := diff.Compare(a.Root, b.Root)
+		if diffOption.JSON {
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", "\t")
+			if err := e.Encode(result); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		} else {
+			printDiff(os.Stdout, result)
+		}
+		if result.Empty() {
+			return 0
+		}
+		return 1
+	},
+}
+
+// printDiff writes a human-readable form of a diff result.
+func printDiff(w io.Writer, r *diff.Result) {
+	for _, inst := range r.Removed {
+		fmt.Fprintf(w, "- %s (%s)\n", inst.Path, inst.ClassName)
+	}
+	for _, inst := range r.Added {
+		fmt.Fprintf(w, "+ %s (%s)\n", inst.Path, inst.ClassName)
+	}
+	for _, move := range r.Moved {
+		fmt.Fprintf(w, "> %s -> %s (%s)\n", move.From, move.To, move.ClassName)
+	}
+	for _, change := range r.Changed {
+		switch {
+		case change.OldType == "":
+			fmt.Fprintf(w, "~ %s.%s: added %s = %s\n", change.Path, change.Property, change.NewType, change.New)
+		case change.NewType == "":
+			fmt.Fprintf(w, "~ %s.%s: removed %s = %s\n", change.Path, change.Property, change.OldType, change.Old)
+		case change.OldType != change.NewType:
+			fmt.Fprintf(w, "~ %s.%s: %s = %s -> %s = %s\n", change.Path, change.Property, change.OldType, change.Old, change.NewType, change.New)
+		default:
+			fmt.Fprintf(w, "~ %s.%s: %s -> %s\n", change.Path, change.Property, change.Old, change.New)
+		}
+	}
+}
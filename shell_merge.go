@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anaminus/rbxplore/diff"
+	"os"
+)
+
+// The following commands integrate with git. To use them, add the following
+// to .gitattributes:
+//
+//     *.rbxl diff=rbxplore merge=rbxplore
+//     *.rbxm diff=rbxplore merge=rbxplore
+//
+// Then configure the drivers:
+//
+//     git config diff.rbxplore.textconv "rbxplore --shell textconv"
+//     git config merge.rbxplore.driver "rbxplore --shell merge-driver %O %A %B %P"
+
+var textconvCommand = &ShellCommand{
+	Name:    "textconv",
+	Args:    "<file>",
+	Summary: "Write a canonical text representation of a file, suitable for diffing.",
+	Run: func(args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "textconv requires one file")
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+		if err := diff.WriteText(os.Stdout, session.Root); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return 0
+	},
+}
+
+var mergeDriverCommand = &ShellCommand{
+	Name:    "merge-driver",
+	Args:    "<base> <ours> <theirs> [path]",
+	Summary: "Merge the changes from base to theirs into ours, writing the result to ours. Conflicting edits are resolved in favor of ours, and are written to standard error with conflict markers. Exits with 1 if there are conflicts.",
+	Run: func(args []string) int {
+		if len(args) != 3 && len(args) != 4 {
+			fmt.Fprintln(os.Stderr, "merge-driver requires base, ours, and theirs files")
+			return 2
+		}
+		sessions := make([]*Session, 3)
+		for i, file := range args[:3] {
+			session, err := openSession(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", file, err)
+				return 2
+			}
+			sessions[i] = session
+		}
+		base, ours, theirs := sessions[0], sessions[1], sessions[2]
+
+		conflicts := diff.Merge(base.Root, ours.Root, theirs.Root)
+		// The files are temporary copies made by git, so they have no
+		// backups or history worth keeping.
+		ours.Backups = 0
+		ours.History = false
+		if err := ours.EncodeFile(); err != nil {
+			fmt.Fprintf(os.Stderr, "could not encode %s: %s\n", ours.File, err)
+			return 2
+		}
+		if len(conflicts) == 0 {
+			return 0
+		}
+
+		name := ours.File
+		if len(args) == 4 {
+			name = args[3]
+		}
+		for _, conflict := range conflicts {
+			conflict.WriteMarkers(os.Stderr)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d conflicts\n", name, len(conflicts))
+		return 1
+	},
+}
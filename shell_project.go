@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/format"
+	"github.com/anaminus/rbxplore/project"
+	"os"
+)
+
+var unpackCommand = &ShellCommand{
+	Name:    "unpack",
+	Args:    "<file> <directory>",
+	Summary: "Write a file to a project directory, with a directory for each instance. An existing project in the directory is replaced.",
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "unpack requires a file and a directory")
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+		if err := project.Unpack(session.Root, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "could not unpack to %s: %s\n", args[1], err)
+			return 2
+		}
+		return 0
+	},
+}
+
+var packOption struct {
+	Format string
+	Watch  bool
+}
+
+var packCommand = &ShellCommand{
+	Name:    "pack",
+	Args:    "<directory> <file>",
+	Summary: "Read a project directory written by unpack, and encode it to a file. The format is determined by the extension of the file.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.StringVar(&packOption.Format, "format", "", "The format of the file, overriding the extension.")
+		flags.BoolVar(&packOption.Watch, "watch", false, "Pack the directory again each time it changes, until interrupted.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "pack requires a directory and a file")
+			return 2
+		}
+		var f format.Format
+		if packOption.Format != "" {
+			if f = format.FromString(packOption.Format); f == format.None {
+				fmt.Fprintf(os.Stderr, "unknown format `%s`\n", packOption.Format)
+				return 2
+			}
+		} else if f = format.FromExt(args[1]); f == format.None {
+			fmt.Fprintf(os.Stderr, "could not determine format of %s\n", args[1])
+			return 2
+		}
+
+		if packOption.Watch || Option.Watch {
+			if args[1] == StdStream {
+				fmt.Fprintln(os.Stderr, "cannot watch when writing to standard output")
+				return 2
+			}
+			return runWatched(args[:1], func() int {
+				return packProject(args[0], args[1], f)
+			})
+		}
+		return packProject(args[0], args[1], f)
+	},
+}
+
+// packProject packs the project in dir, and encodes it to file with format f.
+func packProject(dir, file string, f format.Format) int {
+	root, err := project.Pack(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not pack %s: %s\n", dir, err)
+		return 2
+	}
+	session, _ := NewSession("")
+	session.Root = root
+	session.Format = f
+	if file == StdStream {
+		err = session.Encode(os.Stdout)
+	} else {
+		session.File = file
+		err = session.EncodeFile()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not encode %s: %s\n", file, err)
+		return 2
+	}
+	return 0
+}
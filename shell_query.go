@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/query"
+	"github.com/anaminus/rbxplore/walk"
+	"os"
+)
+
+var queryOption struct {
+	JSON bool
+}
+
+// queryMatch is a single instance matched by the query command.
+type queryMatch struct {
+	Path      string `json:"path"`
+	ClassName string `json:"class"`
+}
+
+var queryCommand = &ShellCommand{
+	Name:    "query",
+	Args:    "<selector> <file>",
+	Summary: "Print the path of each instance in a file matched by a selector. Exits with 1 if no instances match.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&queryOption.JSON, "json", false, "Output matches as JSON.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "query requires a selector and a file")
+			return 2
+		}
+		sel, err := query.Parse(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "bad selector: %s\n", err)
+			return 2
+		}
+		session, err := openSession(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[1], err)
+			return 2
+		}
+
+		matches := []queryMatch{}
+		for _, inst := range sel.Select(Data.API, session.Root) {
+			matches = append(matches, queryMatch{Path: walk.FullName(inst), ClassName: inst.ClassName})
+		}
+		if queryOption.JSON {
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", "\t")
+			if err := e.Encode(matches); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		} else {
+			for _, match := range matches {
+				fmt.Fprintln(os.Stdout, match.Path)
+			}
+		}
+		if len(matches) == 0 {
+			return 1
+		}
+		return 0
+	},
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/validate"
+	"os"
+)
+
+var refsOption struct {
+	Repair bool
+	Output string
+}
+
+var refsCommand = &ShellCommand{
+	Name:    "refs",
+	Args:    "<file>",
+	Summary: "Check a file for instances that share a referent, and for references to instances outside of the file. Exits with 1 if problems remain.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&refsOption.Repair, "repair", false, "Give new referents to duplicate instances, and set dangling references to nil, then save the file.")
+		flags.StringVar(&refsOption.Output, "output", "", "Save the repaired file here instead of overwriting the input.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "refs requires one file")
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+
+		problems := validate.CheckReferences(session.Root)
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", args[0], problem)
+		}
+		if len(problems) == 0 {
+			return 0
+		}
+		if !refsOption.Repair {
+			return 1
+		}
+
+		if err := session.Action.Do(validate.RepairReferences(session.Root)); err != nil {
+			fmt.Fprintf(os.Stderr, "could not repair %s: %s\n", args[0], err)
+			return 2
+		}
+		if refsOption.Output != "" {
+			session.File = refsOption.Output
+		}
+		if session.File == "" || session.File == StdStream {
+			err = session.Encode(os.Stdout)
+		} else {
+			err = session.EncodeFile()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not encode %s: %s\n", session.File, err)
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "repaired %d problems\n", len(problems))
+		return 0
+	},
+}
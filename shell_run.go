@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anaminus/rbxplore/script"
+	"os"
+)
+
+var runCommand = &ShellCommand{
+	Name:    "run",
+	Args:    "<script> <file> [output]",
+	Summary: "Run a Lua script against the instances of a file, then save the result to output, or to the file itself. Nothing is saved if the script fails.",
+	Run: func(args []string) int {
+		if len(args) != 2 && len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "run requires a script and a file")
+			return 2
+		}
+		src, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer src.Close()
+
+		session, err := openSession(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[1], err)
+			return 2
+		}
+
+		runner := script.NewRunner(session.Root, session.Action, Data.API)
+		defer runner.Close()
+		if err := runner.Run(args[0], src); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		if len(args) == 3 {
+			session.File = args[2]
+		}
+		if !session.Unsaved() && session.File == args[1] {
+			return 0
+		}
+		if session.File == "" || session.File == StdStream {
+			err = session.Encode(os.Stdout)
+		} else {
+			err = session.EncodeFile()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not encode %s: %s\n", session.File, err)
+			return 2
+		}
+		return 0
+	},
+}
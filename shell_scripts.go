@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/project"
+	"os"
+)
+
+var extractScriptsCommand = &ShellCommand{
+	Name:    "extract-scripts",
+	Args:    "<file> <directory>",
+	Summary: "Write the source of each script in a file to a .lua file within a directory that mirrors the hierarchy of instances.",
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "extract-scripts requires a file and a directory")
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+		n, err := project.ExtractScripts(session.Root, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Fprintf(os.Stdout, "%d scripts extracted\n", n)
+		return 0
+	},
+}
+
+var injectScriptsOption struct {
+	Output string
+}
+
+var injectScriptsCommand = &ShellCommand{
+	Name:    "inject-scripts",
+	Args:    "<file> <directory>",
+	Summary: "Read the .lua files written by extract-scripts from a directory back into the scripts of a file, then save the file.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.StringVar(&injectScriptsOption.Output, "output", "", "Save the result here instead of overwriting the input.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "inject-scripts requires a file and a directory")
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+		a, unmatched, err := project.InjectScripts(session.Root, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, file := range unmatched {
+			fmt.Fprintf(os.Stderr, "warning: %s does not correspond to a script\n", file)
+		}
+		if a != nil {
+			if err := session.Action.Do(a); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		}
+
+		if injectScriptsOption.Output != "" {
+			session.File = injectScriptsOption.Output
+		} else if a == nil {
+			fmt.Fprintln(os.Stdout, "no scripts changed")
+			return 0
+		}
+		if session.File == "" || session.File == StdStream {
+			err = session.Encode(os.Stdout)
+		} else {
+			err = session.EncodeFile()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not encode %s: %s\n", session.File, err)
+			return 2
+		}
+		return 0
+	},
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/format"
+	"github.com/anaminus/rbxplore/walk"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+var statsOption struct {
+	JSON bool
+	Top  int
+}
+
+// countValue is a flag.Value for an int that must not be negative.
+type countValue int
+
+func (v *countValue) String() string {
+	return strconv.Itoa(int(*v))
+}
+
+func (v *countValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errors.New("must not be negative")
+	}
+	*v = countValue(n)
+	return nil
+}
+
+// valueSizes contains the approximate size of each value type with a fixed
+// size, as encoded in the binary format.
+var valueSizes = map[rbxfile.Type]int{
+	rbxfile.TypeBool:         1,
+	rbxfile.TypeInt:          4,
+	rbxfile.TypeFloat:        4,
+	rbxfile.TypeDouble:       8,
+	rbxfile.TypeUDim:         8,
+	rbxfile.TypeUDim2:        16,
+	rbxfile.TypeRay:          24,
+	rbxfile.TypeFaces:        1,
+	rbxfile.TypeAxes:         1,
+	rbxfile.TypeBrickColor:   4,
+	rbxfile.TypeColor3:       12,
+	rbxfile.TypeVector2:      8,
+	rbxfile.TypeVector3:      12,
+	rbxfile.TypeCFrame:       48,
+	rbxfile.TypeToken:        4,
+	rbxfile.TypeReference:    4,
+	rbxfile.TypeVector3int16: 6,
+	rbxfile.TypeVector2int16: 4,
+	rbxfile.TypeNumberRange:  8,
+	rbxfile.TypeRect2D:       16,
+}
+
+// valueSize returns the approximate size of a value when encoded.
+func valueSize(value rbxfile.Value) int {
+	switch v := value.(type) {
+	case rbxfile.ValueString:
+		return 4 + len(v)
+	case rbxfile.ValueBinaryString:
+		return 4 + len(v)
+	case rbxfile.ValueProtectedString:
+		return 4 + len(v)
+	case rbxfile.ValueContent:
+		return 4 + len(v)
+	case rbxfile.ValueNumberSequence:
+		return 4 + 12*len(v)
+	case rbxfile.ValueColorSequence:
+		return 4 + 20*len(v)
+	}
+	return valueSizes[value.Type()]
+}
+
+// statsCount is the number of occurrences of a class or type.
+type statsCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// Size is the total approximate size of properties of a type.
+	Size int `json:"size,omitempty"`
+}
+
+type statsProperty struct {
+	Path     string `json:"path"`
+	Property string `json:"property"`
+	Type     string `json:"type"`
+	Size     int    `json:"size"`
+}
+
+type statsPath struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+}
+
+type statsChunk struct {
+	Name         string `json:"name"`
+	Count        int    `json:"count"`
+	Size         int64  `json:"size"`
+	Uncompressed int64  `json:"uncompressed"`
+}
+
+// fileStats is the report produced by the stats command.
+type fileStats struct {
+	File      string          `json:"file"`
+	Format    string          `json:"format"`
+	Size      int64           `json:"size"`
+	Instances int             `json:"instances"`
+	Classes   []statsCount    `json:"classes"`
+	Types     []statsCount    `json:"types"`
+	Largest   []statsProperty `json:"largest"`
+	Deepest   []statsPath     `json:"deepest"`
+	Chunks    []statsChunk    `json:"chunks,omitempty"`
+}
+
+// sortCounts returns counts sorted by descending count, then name.
+func sortCounts(m map[string]*statsCount) []statsCount {
+	counts := make([]statsCount, 0, len(m))
+	for _, c := range m {
+		counts = append(counts, *c)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// collectStats gathers statistics of the instances in root, limiting lists
+// of properties and paths to top entries.
+func collectStats(root *rbxfile.Root, top int) *fileStats {
+	stats := &fileStats{}
+	classes := map[string]*statsCount{}
+	types := map[string]*statsCount{}
+	walk.Walk(root, func(inst *rbxfile.Instance, depth int) bool {
+		stats.Instances++
+		if c := classes[inst.ClassName]; c != nil {
+			c.Count++
+		} else {
+			classes[inst.ClassName] = &statsCount{Name: inst.ClassName, Count: 1}
+		}
+
+		path := walk.FullName(inst)
+		for name, value := range inst.Properties {
+			typ := value.Type().String()
+			size := valueSize(value)
+			if c := types[typ]; c != nil {
+				c.Count++
+				c.Size += size
+			} else {
+				types[typ] = &statsCount{Name: typ, Count: 1, Size: size}
+			}
+			stats.Largest = append(stats.Largest, statsProperty{Path: path, Property: name, Type: typ, Size: size})
+		}
+		stats.Deepest = append(stats.Deepest, statsPath{Path: path, Depth: depth})
+		return true
+	})
+	stats.Classes = sortCounts(classes)
+	stats.Types = sortCounts(types)
+
+	sort.SliceStable(stats.Largest, func(i, j int) bool {
+		return stats.Largest[i].Size > stats.Largest[j].Size
+	})
+	if len(stats.Largest) > top {
+		stats.Largest = stats.Largest[:top]
+	}
+	sort.SliceStable(stats.Deepest, func(i, j int) bool {
+		return stats.Deepest[i].Depth > stats.Deepest[j].Depth
+	})
+	if len(stats.Deepest) > top {
+		stats.Deepest = stats.Deepest[:top]
+	}
+	return stats
+}
+
+// collectChunks gathers the byte usage of each kind of chunk in content
+// encoded in the binary format.
+func collectChunks(content []byte) ([]statsChunk, error) {
+	_, chunks, err := format.ReadChunks(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	var list []statsChunk
+	index := map[string]int{}
+	for _, chunk := range chunks {
+		i, ok := index[chunk.Name]
+		if !ok {
+			i = len(list)
+			index[chunk.Name] = i
+			list = append(list, statsChunk{Name: chunk.Name})
+		}
+		list[i].Count++
+		list[i].Size += chunk.Length
+		list[i].Uncompressed += int64(chunk.Uncompressed)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Size > list[j].Size
+	})
+	return list, nil
+}
+
+// printStats writes a report as a number of tables.
+func printStats(w io.Writer, stats *fileStats) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "%s (%s): %d bytes, %d instances\n", stats.File, stats.Format, stats.Size, stats.Instances)
+
+	fmt.Fprintf(w, "\nInstances by class:\n")
+	for _, c := range stats.Classes {
+		fmt.Fprintf(tw, "\t%d\t  %s\n", c.Count, c.Name)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nProperties by type (count, estimated bytes):\n")
+	for _, c := range stats.Types {
+		fmt.Fprintf(tw, "\t%d\t%d\t  %s\n", c.Count, c.Size, c.Name)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nLargest properties (estimated bytes):\n")
+	for _, p := range stats.Largest {
+		fmt.Fprintf(tw, "\t%d\t  %s.%s (%s)\n", p.Size, p.Path, p.Property, p.Type)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nDeepest paths:\n")
+	for _, p := range stats.Deepest {
+		fmt.Fprintf(tw, "\t%d\t  %s\n", p.Depth, p.Path)
+	}
+	tw.Flush()
+
+	if len(stats.Chunks) > 0 {
+		fmt.Fprintf(w, "\nChunks (count, bytes, uncompressed bytes):\n")
+		for _, c := range stats.Chunks {
+			fmt.Fprintf(tw, "\t%d\t%d\t%d\t  %s\n", c.Count, c.Size, c.Uncompressed, c.Name)
+		}
+		tw.Flush()
+	}
+}
+
+var statsCommand = &ShellCommand{
+	Name:    "stats",
+	Args:    "<file>",
+	Summary: "Report the instances, properties, and size of a file. The sizes of properties are estimated from the binary format. For binary files, the size of each kind of chunk is also reported.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&statsOption.JSON, "json", false, "Output statistics as JSON.")
+		statsOption.Top = 10
+		flags.Var((*countValue)(&statsOption.Top), "top", "The number of largest properties and deepest paths to report.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "stats requires one file")
+			return 2
+		}
+		file := args[0]
+
+		var content []byte
+		var err error
+		if file == StdStream {
+			content, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			content, err = ioutil.ReadFile(file)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		session, _ := NewSession("")
+		if file != StdStream {
+			session.File = file
+		}
+		if err := session.Decode(bytes.NewReader(content)); err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", file, err)
+			return 2
+		}
+		for _, warning := range session.Warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+
+		stats := collectStats(session.Root, statsOption.Top)
+		stats.File = file
+		stats.Format = session.Format.String()
+		stats.Size = int64(len(content))
+		if session.Format.Encoding() == format.RBXL {
+			if stats.Chunks, err = collectChunks(content); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not read chunks: %s\n", err)
+			}
+		}
+
+		if statsOption.JSON {
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", format.Indent)
+			if err := e.Encode(stats); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		} else {
+			printStats(os.Stdout, stats)
+		}
+		return 0
+	},
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/diff"
+	"github.com/anaminus/rbxplore/format"
+	"github.com/anaminus/rbxplore/walk"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+var treeOption struct {
+	Props  bool
+	Depth  int
+	Path   string
+	Format string
+}
+
+// treeProperty is a property of an instance in the tree command.
+type treeProperty struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// treeNode is an instance in the tree command.
+type treeNode struct {
+	Name       string                   `json:"name"`
+	ClassName  string                   `json:"class"`
+	Path       string                   `json:"path,omitempty"`
+	Properties map[string]*treeProperty `json:"properties,omitempty"`
+	Children   []*treeNode              `json:"children,omitempty"`
+}
+
+// buildTree creates a node for inst and its descendants, up to depth levels.
+// A depth of 0 or less is unlimited.
+func buildTree(inst *rbxfile.Instance, props bool, depth int) *treeNode {
+	node := &treeNode{
+		Name:      inst.Name(),
+		ClassName: inst.ClassName,
+	}
+	if props {
+		node.Properties = make(map[string]*treeProperty, len(inst.Properties))
+		for name, value := range inst.Properties {
+			node.Properties[name] = &treeProperty{Type: value.Type().String(), Value: diff.Display(value)}
+		}
+	}
+	if depth != 1 {
+		for _, child := range inst.Children {
+			node.Children = append(node.Children, buildTree(child, props, depth-1))
+		}
+	}
+	return node
+}
+
+// splitPattern splits a pattern into names at each dot. A dot escaped with a
+// backslash is part of a name, and remains escaped, so that it matches a
+// literal dot.
+func splitPattern(pattern string) []string {
+	var names []string
+	start := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '.':
+			names = append(names, pattern[start:i])
+			start = i + 1
+		}
+	}
+	return append(names, pattern[start:])
+}
+
+// matchPath returns whether the path of inst matches a pattern of names, as
+// returned by splitPattern. Each name in the pattern may contain wildcards,
+// as accepted by path.Match.
+func matchPath(pattern []string, inst *rbxfile.Instance) bool {
+	names := walk.Path(inst)
+	if len(names) != len(pattern) {
+		return false
+	}
+	for i, name := range names {
+		if ok, _ := path.Match(pattern[i], name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedProperties returns the names of the properties of a node, sorted.
+func (node *treeNode) sortedProperties() []string {
+	names := make([]string, 0, len(node.Properties))
+	for name := range node.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeTreePlain writes nodes with each level indented by a tab.
+func writeTreePlain(w *bufio.Writer, nodes []*treeNode, indent string) {
+	for _, node := range nodes {
+		name := node.Name
+		if node.Path != "" {
+			name = node.Path
+		}
+		fmt.Fprintf(w, "%s%s (%s)\n", indent, name, node.ClassName)
+		for _, prop := range node.sortedProperties() {
+			value := node.Properties[prop]
+			fmt.Fprintf(w, "%s\t.%s: %s = %s\n", indent, prop, value.Type, strings.Replace(value.Value, "\n", "\\n", -1))
+		}
+		writeTreePlain(w, node.Children, indent+"\t")
+	}
+}
+
+// yamlReserved contains plain scalars that YAML readers do not read as
+// strings, compared in lower case.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+	".inf": true, "+.inf": true, "-.inf": true, ".nan": true,
+}
+
+// yamlPlain returns whether a string can be written as a plain YAML scalar
+// that is read back as the same string.
+func yamlPlain(s string) bool {
+	switch {
+	case s == "",
+		strings.ContainsAny(s, ":#'\"\n\t[]{},&*!|>%@`"),
+		strings.TrimSpace(s) != s,
+		s[0] == '-' || s[0] == '?',
+		yamlReserved[strings.ToLower(s)]:
+		return false
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return false
+	}
+	return true
+}
+
+// yamlString quotes a string when it cannot be written as a plain YAML
+// scalar.
+func yamlString(s string) string {
+	if !yamlPlain(s) {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	return s
+}
+
+// writeTreeYAML writes nodes as a YAML-like list.
+func writeTreeYAML(w *bufio.Writer, nodes []*treeNode, indent string) {
+	for _, node := range nodes {
+		fmt.Fprintf(w, "%s- name: %s\n", indent, yamlString(node.Name))
+		fmt.Fprintf(w, "%s  class: %s\n", indent, node.ClassName)
+		if node.Path != "" {
+			fmt.Fprintf(w, "%s  path: %s\n", indent, yamlString(node.Path))
+		}
+		if len(node.Properties) > 0 {
+			fmt.Fprintf(w, "%s  properties:\n", indent)
+			for _, prop := range node.sortedProperties() {
+				value := node.Properties[prop]
+				fmt.Fprintf(w, "%s    %s: {type: %s, value: %s}\n", indent, prop, value.Type, yamlString(value.Value))
+			}
+		}
+		if len(node.Children) > 0 {
+			fmt.Fprintf(w, "%s  children:\n", indent)
+			writeTreeYAML(w, node.Children, indent+"    ")
+		}
+	}
+}
+
+// writeTree writes nodes in the given form, which is "plain", "json", or
+// "yaml".
+func writeTree(w io.Writer, nodes []*treeNode, form string) error {
+	if form == "json" {
+		e := json.NewEncoder(w)
+		e.SetIndent("", format.Indent)
+		return e.Encode(nodes)
+	}
+	bw := bufio.NewWriter(w)
+	switch form {
+	case "plain":
+		writeTreePlain(bw, nodes, "")
+	case "yaml":
+		writeTreeYAML(bw, nodes, "")
+	}
+	return bw.Flush()
+}
+
+var treeCommand = &ShellCommand{
+	Name:    "tree",
+	Args:    "<file>",
+	Summary: "Print the hierarchy of instances in a file.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&treeOption.Props, "props", false, "Include the properties of each instance.")
+		flags.IntVar(&treeOption.Depth, "depth", 0, "Print at most this many levels of instances. 0 is unlimited.")
+		flags.StringVar(&treeOption.Path, "path", "", "Print only the instances whose path matches this pattern, along with their descendants. The pattern is a list of names separated by dots, which may contain wildcards (e.g. `Workspace.*`). A dot within a name is escaped with a backslash (e.g. `Workspace.Part\\.1`).")
+		flags.StringVar(&treeOption.Format, "format", "plain", "The form of the output: plain, json, or yaml.")
+	},
+	Run: func(args []string) int {
+		if len(args) != 1 {
+			fmt.Fprintln(os.Stderr, "tree requires one file")
+			return 2
+		}
+		switch treeOption.Format {
+		case "plain", "json", "yaml":
+		default:
+			fmt.Fprintf(os.Stderr, "unknown tree format `%s`\n", treeOption.Format)
+			return 2
+		}
+		session, err := openSession(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", args[0], err)
+			return 2
+		}
+
+		var nodes []*treeNode
+		if treeOption.Path == "" {
+			for _, inst := range session.Root.Instances {
+				nodes = append(nodes, buildTree(inst, treeOption.Props, treeOption.Depth))
+			}
+		} else {
+			pattern := splitPattern(treeOption.Path)
+			walk.Walk(session.Root, func(inst *rbxfile.Instance, depth int) bool {
+				if depth+1 < len(pattern) {
+					return true
+				}
+				if matchPath(pattern, inst) {
+					node := buildTree(inst, treeOption.Props, treeOption.Depth)
+					node.Path = walk.FullName(inst)
+					nodes = append(nodes, node)
+				}
+				return false
+			})
+		}
+		if nodes == nil {
+			nodes = []*treeNode{}
+		}
+
+		if err := writeTree(os.Stdout, nodes, treeOption.Format); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return 0
+	},
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/anaminus/rbxplore/format"
+	"github.com/anaminus/rbxplore/validate"
+	"os"
+)
+
+var validateOption struct {
+	JSON  bool
+	Level string
+}
+
+// validateResult is a problem reported by the validate command.
+type validateResult struct {
+	File     string `json:"file"`
+	Severity string `json:"severity"`
+	Path     string `json:"path"`
+	Property string `json:"property,omitempty"`
+	Message  string `json:"message"`
+}
+
+var validateCommand = &ShellCommand{
+	Name:    "validate",
+	Args:    "<file>...",
+	Summary: "Check the instances of each file against the API dump. Exits with 1 if any errors are found.",
+	Flags: func(flags *flag.FlagSet) {
+		flags.BoolVar(&validateOption.JSON, "json", false, "Output problems as JSON.")
+		flags.StringVar(&validateOption.Level, "level", "info", "Report only problems of at least this severity: info, warning, or error.")
+	},
+	Run: func(args []string) int {
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, "validate requires at least one file")
+			return 2
+		}
+		level, ok := validate.SeverityFromString(validateOption.Level)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown severity `%s`\n", validateOption.Level)
+			return 2
+		}
+		if Data.API == nil {
+			fmt.Fprintln(os.Stderr, "warning: API dump is not loaded; only references will be checked")
+		}
+
+		code := 0
+		results := []validateResult{}
+		for _, file := range args {
+			session, err := openSession(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "could not decode %s: %s\n", file, err)
+				code = 2
+				continue
+			}
+			for _, problem := range validate.Check(session.Root, Data.API) {
+				if problem.Severity == validate.Error && code == 0 {
+					code = 1
+				}
+				if problem.Severity < level {
+					continue
+				}
+				results = append(results, validateResult{
+					File:     file,
+					Severity: problem.Severity.String(),
+					Path:     problem.Path,
+					Property: problem.Property,
+					Message:  problem.Message,
+				})
+				if !validateOption.JSON {
+					fmt.Fprintf(os.Stdout, "%s: %s\n", file, problem)
+				}
+			}
+		}
+		if validateOption.JSON {
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", format.Indent)
+			if err := e.Encode(results); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+		}
+		return code
+	},
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anaminus/rbxplore/watch"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchPaths returns the paths to watch for the given inputs. A pattern is
+// watched through the nearest directory that is not a pattern.
+func watchPaths(inputs []string) []string {
+	paths := make([]string, len(inputs))
+	for i, input := range inputs {
+		for isGlob(input) {
+			if _, err := os.Stat(input); err == nil {
+				break
+			}
+			input = filepath.Dir(input)
+		}
+		paths[i] = input
+	}
+	return paths
+}
+
+// runWatched calls run, then calls it again each time any of the paths
+// change. Failures are reported, but do not stop watching. Changes made by run
+// itself, such as outputs written within the paths, are ignored. Does not
+// return.
+func runWatched(paths []string, run func() int) int {
+	w := watch.New(paths...)
+	report := func() {
+		code := run()
+		w.Sync()
+		if code != 0 {
+			fmt.Fprintf(os.Stderr, "%s: failed with status %d\n", time.Now().Format("15:04:05"), code)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: done\n", time.Now().Format("15:04:05"))
+		}
+		fmt.Fprintln(os.Stderr, "watching for changes...")
+	}
+	report()
+	w.Run(report)
+	return 0
+}
@@ -0,0 +1,132 @@
+package validate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/cmd"
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxfile"
+)
+
+// refState contains the referents and instances of a tree.
+type refState struct {
+	// inTree contains each instance in the tree.
+	inTree map[*rbxfile.Instance]bool
+	// holders maps each referent to the instances that have it, in tree
+	// order.
+	holders map[string][]*rbxfile.Instance
+}
+
+func scanReferences(root *rbxfile.Root) *refState {
+	s := &refState{
+		inTree:  map[*rbxfile.Instance]bool{},
+		holders: map[string][]*rbxfile.Instance{},
+	}
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		s.inTree[inst] = true
+		if inst.Reference != "" {
+			s.holders[inst.Reference] = append(s.holders[inst.Reference], inst)
+		}
+		return true
+	})
+	return s
+}
+
+// dangling returns the names of the properties of inst that reference an
+// instance that is not in the tree, sorted.
+func (s *refState) dangling(inst *rbxfile.Instance) []string {
+	var names []string
+	for name, value := range inst.Properties {
+		ref, ok := value.(rbxfile.ValueReference)
+		if ok && ref.Instance != nil && !s.inTree[ref.Instance] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// check returns the reference problems of inst.
+func (s *refState) check(inst *rbxfile.Instance, path string) []Problem {
+	var problems []Problem
+	if holders := s.holders[inst.Reference]; len(holders) > 1 && holders[0] != inst {
+		problems = append(problems, Problem{
+			Severity: Error,
+			Instance: inst,
+			Path:     path,
+			Message:  fmt.Sprintf("referent %q is already used by %s", inst.Reference, walk.FullName(holders[0])),
+		})
+	}
+	for _, name := range s.dangling(inst) {
+		problems = append(problems, Problem{
+			Severity: Error,
+			Instance: inst,
+			Path:     path,
+			Property: name,
+			Message:  "references an instance outside of the file",
+		})
+	}
+	return problems
+}
+
+// CheckReferences checks the integrity of the references in root. Instances
+// that share a referent with an earlier instance are reported, along with
+// reference properties that point to instances that are not in root, such as
+// instances that have been removed.
+func CheckReferences(root *rbxfile.Root) []Problem {
+	s := scanReferences(root)
+	var problems []Problem
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		problems = append(problems, s.check(inst, walk.FullName(inst))...)
+		return true
+	})
+	return problems
+}
+
+// NewReferent returns a random referent for which used returns false.
+func NewReferent(used func(ref string) bool) string {
+	var b [16]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		ref := "RBX" + strings.ToUpper(hex.EncodeToString(b[:]))
+		if !used(ref) {
+			return ref
+		}
+	}
+}
+
+// RepairReferences returns an action that repairs the problems reported by
+// CheckReferences. Each instance that shares a referent with an earlier
+// instance receives a new unique referent, and each property that references
+// an instance outside of root is set to nil. Returns nil if there is nothing
+// to repair.
+func RepairReferences(root *rbxfile.Root) action.Action {
+	s := scanReferences(root)
+	used := func(ref string) bool {
+		_, ok := s.holders[ref]
+		return ok
+	}
+	var group action.Group
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		if holders := s.holders[inst.Reference]; len(holders) > 1 && holders[0] != inst {
+			ref := NewReferent(used)
+			s.holders[ref] = []*rbxfile.Instance{inst}
+			group = append(group, cmd.SetReference(inst, ref))
+		}
+		for _, name := range s.dangling(inst) {
+			group = append(group, cmd.SetProperty(inst, name, rbxfile.ValueReference{}))
+		}
+		return true
+	})
+	if len(group) == 0 {
+		return nil
+	}
+	return group
+}
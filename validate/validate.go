@@ -0,0 +1,219 @@
+// Package validate checks trees of instances against an API dump.
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/anaminus/rbxplore/walk"
+	"github.com/robloxapi/rbxapi"
+	"github.com/robloxapi/rbxfile"
+)
+
+// Severity indicates how serious a problem is.
+type Severity int
+
+const (
+	// Info is a problem that is unlikely to affect the file.
+	Info Severity = iota
+	// Warning is a problem that may cause data to be ignored or lost.
+	Warning
+	// Error is a problem that causes data to be invalid.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return "unknown"
+}
+
+// SeverityFromString returns the Severity named by s. ok is false if s does
+// not name a severity.
+func SeverityFromString(s string) (sev Severity, ok bool) {
+	for sev = Info; sev <= Error; sev++ {
+		if sev.String() == s {
+			return sev, true
+		}
+	}
+	return Info, false
+}
+
+// Problem describes a single problem found in a tree.
+type Problem struct {
+	Severity Severity
+	// Instance is the instance containing the problem.
+	Instance *rbxfile.Instance
+	// Path is the full name of Instance.
+	Path string
+	// Property is the name of the property containing the problem, if any.
+	Property string
+	Message  string
+}
+
+func (p Problem) String() string {
+	loc := p.Path
+	if p.Property != "" {
+		loc += "." + p.Property
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Severity, loc, p.Message)
+}
+
+// findProperty returns the descriptor of a property of a class or any of its
+// superclasses, or nil if it could not be found.
+func findProperty(api *rbxapi.API, class *rbxapi.Class, name string) *rbxapi.Property {
+	for i := 0; class != nil && i < len(api.Classes); i++ {
+		for _, member := range class.Members {
+			if prop, ok := member.(*rbxapi.Property); ok && prop.MemberName == name {
+				return prop
+			}
+		}
+		class = api.Classes[class.Superclass]
+	}
+	return nil
+}
+
+// valueTypes maps the names of value types used by API dumps to the types of
+// rbxfile. The names of some types differ from those of rbxfile.
+var valueTypes = map[string]rbxfile.Type{
+	"bool":            rbxfile.TypeBool,
+	"int":             rbxfile.TypeInt,
+	"float":           rbxfile.TypeFloat,
+	"double":          rbxfile.TypeDouble,
+	"string":          rbxfile.TypeString,
+	"BinaryString":    rbxfile.TypeBinaryString,
+	"ProtectedString": rbxfile.TypeProtectedString,
+	"Content":         rbxfile.TypeContent,
+	"Object":          rbxfile.TypeReference,
+	"CoordinateFrame": rbxfile.TypeCFrame,
+	"CFrame":          rbxfile.TypeCFrame,
+	"UDim":            rbxfile.TypeUDim,
+	"UDim2":           rbxfile.TypeUDim2,
+	"Ray":             rbxfile.TypeRay,
+	"Faces":           rbxfile.TypeFaces,
+	"Axes":            rbxfile.TypeAxes,
+	"BrickColor":      rbxfile.TypeBrickColor,
+	"Color3":          rbxfile.TypeColor3,
+	"Vector2":         rbxfile.TypeVector2,
+	"Vector3":         rbxfile.TypeVector3,
+	"Vector2int16":    rbxfile.TypeVector2int16,
+	"Vector3int16":    rbxfile.TypeVector3int16,
+	"NumberSequence":  rbxfile.TypeNumberSequence,
+	"ColorSequence":   rbxfile.TypeColorSequence,
+	"NumberRange":     rbxfile.TypeNumberRange,
+	"Rect2D":          rbxfile.TypeRect2D,
+}
+
+// ValueType returns the type of values of a property with the given value
+// type, as named by an API dump. Enums are not included, and must be checked
+// separately. TypeInvalid is returned if the type is not known.
+func ValueType(name string) rbxfile.Type {
+	if t, ok := valueTypes[name]; ok {
+		return t
+	}
+	return rbxfile.TypeInvalid
+}
+
+// expectedType returns the value type of a property descriptor, and the enum
+// of the property, if any. TypeInvalid is returned if the type is not known.
+func expectedType(api *rbxapi.API, prop *rbxapi.Property) (rbxfile.Type, *rbxapi.Enum) {
+	if enum := api.Enums[prop.ValueType]; enum != nil {
+		return rbxfile.TypeToken, enum
+	}
+	return ValueType(prop.ValueType), nil
+}
+
+// isString returns whether t is one of the string types, which are encoded
+// interchangeably.
+func isString(t rbxfile.Type) bool {
+	switch t {
+	case rbxfile.TypeString, rbxfile.TypeBinaryString, rbxfile.TypeProtectedString, rbxfile.TypeContent:
+		return true
+	}
+	return false
+}
+
+// Check checks each instance in root against api, returning the problems
+// that were found. Problems are ordered by location. The problems reported by
+// CheckReferences are included. If api is nil, then only references are
+// checked.
+func Check(root *rbxfile.Root, api *rbxapi.API) []Problem {
+	var problems []Problem
+
+	refs := scanReferences(root)
+	walk.Walk(root, func(inst *rbxfile.Instance, _ int) bool {
+		path := walk.FullName(inst)
+		report := func(sev Severity, prop, format string, v ...interface{}) {
+			problems = append(problems, Problem{
+				Severity: sev,
+				Instance: inst,
+				Path:     path,
+				Property: prop,
+				Message:  fmt.Sprintf(format, v...),
+			})
+		}
+
+		// References can be checked without an API.
+		problems = append(problems, refs.check(inst, path)...)
+
+		if api == nil {
+			return true
+		}
+		class := api.Classes[inst.ClassName]
+		if class == nil {
+			report(Error, "", "unknown class %q", inst.ClassName)
+			return true
+		}
+		if class.Tag("deprecated") {
+			report(Warning, "", "class %s is deprecated", class.Name)
+		}
+
+		names := make([]string, 0, len(inst.Properties))
+		for name := range inst.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := inst.Properties[name]
+			prop := findProperty(api, class, name)
+			if prop == nil {
+				report(Warning, name, "%s is not a property of %s", name, inst.ClassName)
+				continue
+			}
+			if prop.Tag("deprecated") {
+				report(Warning, name, "property is deprecated")
+			}
+			if prop.Tag("readonly") {
+				report(Info, name, "property is read-only")
+			}
+
+			typ, enum := expectedType(api, prop)
+			switch {
+			case typ == rbxfile.TypeInvalid:
+			case typ != value.Type() && !(isString(typ) && isString(value.Type())):
+				report(Error, name, "value is %s, but property is %s", value.Type(), prop.ValueType)
+			case enum != nil:
+				token, _ := value.(rbxfile.ValueToken)
+				found := false
+				for _, item := range enum.Items {
+					if item.Value == int(token) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					report(Error, name, "%s is not an item of enum %s", strconv.FormatUint(uint64(token), 10), enum.Name)
+				}
+			}
+		}
+		return true
+	})
+	return problems
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/anaminus/gxui"
+	"github.com/anaminus/gxui/math"
+	"github.com/anaminus/rbxplore/action"
+	"github.com/anaminus/rbxplore/validate"
+	"strconv"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+var severityColors = [...]gxui.Color{
+	validate.Info:    {R: 0.7, G: 0.8, B: 1.0, A: 1},
+	validate.Warning: {R: 1.0, G: 0.9, B: 0.5, A: 1},
+	validate.Error:   {R: 1.0, G: 0.5, B: 0.5, A: 1},
+}
+
+// problemsAdapter lists the problems found by validating a tree. The
+// AdapterItems returned by this adapter are indexes into the list.
+type problemsAdapter struct {
+	gxui.AdapterBase
+	problems []validate.Problem
+}
+
+func (a *problemsAdapter) Count() int {
+	return len(a.problems)
+}
+
+func (a *problemsAdapter) ItemAt(index int) gxui.AdapterItem {
+	return index
+}
+
+func (a *problemsAdapter) ItemIndex(item gxui.AdapterItem) int {
+	return item.(int)
+}
+
+func (a *problemsAdapter) Create(theme gxui.Theme, index int) gxui.Control {
+	problem := a.problems[index]
+	label := theme.CreateLabel()
+	label.SetText(problem.String())
+	label.SetColor(severityColors[problem.Severity])
+	return label
+}
+
+func (a *problemsAdapter) Size(gxui.Theme) math.Size {
+	return math.Size{W: math.MaxSize.W, H: 20}
+}
+
+// ValidateContext displays the problems found by validating Root against the
+// API dump. Selecting a problem exits the context, passing the instance of
+// the problem to Finished. If Action is not nil, then problems with
+// references can be repaired.
+type ValidateContext struct {
+	Root     *rbxfile.Root
+	Action   *action.Controller
+	Finished func(inst *rbxfile.Instance)
+	selected *rbxfile.Instance
+}
+
+func (c *ValidateContext) Entering(ctxc *ContextController) ([]gxui.Control, bool) {
+	theme := ctxc.Theme()
+
+	dialog := CreateDialog(theme)
+	dialog.SetTitle("Validate")
+
+	adapter := &problemsAdapter{
+		problems: validate.Check(c.Root, Data.API),
+	}
+	var counts [validate.Error + 1]int
+	for _, problem := range adapter.problems {
+		counts[problem.Severity]++
+	}
+
+	summary := theme.CreateLabel()
+	switch {
+	case Data.API == nil:
+		summary.SetText("The API dump is not loaded; only references were checked.")
+	case len(adapter.problems) == 0:
+		summary.SetText("No problems were found.")
+	default:
+		summary.SetText(strconv.Itoa(counts[validate.Error]) + " errors, " +
+			strconv.Itoa(counts[validate.Warning]) + " warnings, " +
+			strconv.Itoa(counts[validate.Info]) + " notes")
+	}
+	dialog.Container().AddChild(summary)
+
+	if len(adapter.problems) > 0 {
+		list := theme.CreateList()
+		list.SetAdapter(adapter)
+		list.SetDesiredSize(math.Size{W: 600, H: 400})
+		list.OnItemClicked(func(e gxui.MouseEvent, item gxui.AdapterItem) {
+			c.selected = adapter.problems[item.(int)].Instance
+			ctxc.ExitContext()
+		})
+		dialog.Container().AddChild(list)
+	}
+
+	if c.Action != nil {
+		dialog.AddAction("Repair References", len(validate.CheckReferences(c.Root)) > 0, func() {
+			if err := c.Action.Do(action.Labeled{Action: validate.RepairReferences(c.Root), Label: "Repair References"}); err != nil {
+				ctxc.ExitContext()
+				ctxc.EnterContext(&AlertContext{
+					Title:   "Error",
+					Text:    "Failed to repair references:\n" + err.Error(),
+					Buttons: ButtonsOK,
+				})
+				return
+			}
+			ctxc.ExitContext()
+		})
+	}
+	dialog.AddAction("Close", true, func() {
+		ctxc.ExitContext()
+	})
+	return []gxui.Control{dialog.Control()}, true
+}
+
+func (c *ValidateContext) Exiting(*ContextController) {
+	if c.Finished != nil {
+		c.Finished(c.selected)
+	}
+}
+
+func (c *ValidateContext) IsDialog() bool {
+	return true
+}
+
+func (c *ValidateContext) Direction() gxui.Direction {
+	return gxui.TopToBottom
+}
+
+func (c *ValidateContext) HorizontalAlignment() gxui.HorizontalAlignment {
+	return gxui.AlignCenter
+}
+
+func (c *ValidateContext) VerticalAlignment() gxui.VerticalAlignment {
+	return gxui.AlignMiddle
+}
@@ -0,0 +1,69 @@
+// Package walk provides functions for traversing trees of instances.
+package walk
+
+import (
+	"strings"
+
+	"github.com/robloxapi/rbxfile"
+)
+
+// Walk calls fn for each instance in root, in depth-first order. depth is 0
+// for top-level instances. If fn returns false, then the descendants of the
+// instance are skipped.
+func Walk(root *rbxfile.Root, fn func(inst *rbxfile.Instance, depth int) bool) {
+	for _, inst := range root.Instances {
+		walk(inst, 0, fn)
+	}
+}
+
+// Descendants calls fn for inst and each of its descendants, in depth-first
+// order. depth is 0 for inst.
+func Descendants(inst *rbxfile.Instance, fn func(inst *rbxfile.Instance, depth int) bool) {
+	walk(inst, 0, fn)
+}
+
+func walk(inst *rbxfile.Instance, depth int, fn func(*rbxfile.Instance, int) bool) {
+	if !fn(inst, depth) {
+		return
+	}
+	for _, child := range inst.Children {
+		walk(child, depth+1, fn)
+	}
+}
+
+// Path returns the names of inst and each of its ancestors, starting from
+// the top-level ancestor.
+func Path(inst *rbxfile.Instance) []string {
+	var names []string
+	for ; inst != nil; inst = inst.Parent() {
+		names = append(names, inst.Name())
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return names
+}
+
+// FullName returns the path of inst, with each name separated by a dot.
+func FullName(inst *rbxfile.Instance) string {
+	return strings.Join(Path(inst), ".")
+}
+
+// Top returns the top-level ancestor of inst, or inst itself if it has no
+// parent.
+func Top(inst *rbxfile.Instance) *rbxfile.Instance {
+	for inst.Parent() != nil {
+		inst = inst.Parent()
+	}
+	return inst
+}
+
+// Siblings returns the instances that share a parent with inst, including
+// inst. If inst has no parent, then the top-level instances of root are
+// returned.
+func Siblings(root *rbxfile.Root, inst *rbxfile.Instance) []*rbxfile.Instance {
+	if parent := inst.Parent(); parent != nil {
+		return parent.Children
+	}
+	return root.Instances
+}
@@ -0,0 +1,121 @@
+// Package watch detects changes to files and directories by polling.
+package watch
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default durations used by New.
+const (
+	DefaultInterval = 250 * time.Millisecond
+	DefaultDelay    = 500 * time.Millisecond
+)
+
+// Watcher polls a set of files for changes. A directory is watched
+// recursively.
+type Watcher struct {
+	// Interval is the duration between each poll.
+	Interval time.Duration
+	// Delay is how long the files must remain unchanged before a change is
+	// reported. This allows a burst of writes to be reported as one change.
+	Delay time.Duration
+
+	paths []string
+	mutex sync.Mutex
+	seen  uint64
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// New returns a Watcher for the given paths, using the default interval and
+// delay. The current state of the paths is considered to be unchanged.
+func New(paths ...string) *Watcher {
+	w := &Watcher{
+		Interval: DefaultInterval,
+		Delay:    DefaultDelay,
+		paths:    paths,
+		stop:     make(chan struct{}),
+	}
+	w.seen = w.fingerprint()
+	return w
+}
+
+// fingerprint returns a hash of the name, size, and modification time of
+// each file within the watched paths. A path that does not exist contributes
+// only its name, so that its removal and creation are detected.
+func (w *Watcher) fingerprint() uint64 {
+	h := fnv.New64a()
+	for _, path := range w.paths {
+		filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			io.WriteString(h, path)
+			h.Write([]byte{0})
+			if err != nil {
+				return nil
+			}
+			io.WriteString(h, strconv.FormatInt(info.Size(), 16))
+			io.WriteString(h, strconv.FormatInt(info.ModTime().UnixNano(), 16))
+			return nil
+		})
+	}
+	return h.Sum64()
+}
+
+// Sync considers the current state of the paths to be unchanged. This can be
+// used to ignore a change made by the caller.
+func (w *Watcher) Sync() {
+	fp := w.fingerprint()
+	w.mutex.Lock()
+	w.seen = fp
+	w.mutex.Unlock()
+}
+
+// Run polls the paths until Stop is called, calling changed each time the
+// paths change. Run blocks while changed is running, so changes made during
+// the call are reported after it returns.
+func (w *Watcher) Run(changed func()) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	var pending uint64
+	var since time.Time
+	for {
+		var now time.Time
+		select {
+		case <-w.stop:
+			return
+		case now = <-ticker.C:
+		}
+		fp := w.fingerprint()
+		w.mutex.Lock()
+		seen := w.seen
+		w.mutex.Unlock()
+		if fp == seen {
+			pending = fp
+			continue
+		}
+		if fp != pending {
+			// Still changing; wait for it to settle.
+			pending = fp
+			since = now
+			continue
+		}
+		if now.Sub(since) < w.Delay {
+			continue
+		}
+		w.mutex.Lock()
+		w.seen = fp
+		w.mutex.Unlock()
+		changed()
+	}
+}
+
+// Stop causes Run to return. It is safe to call more than once.
+func (w *Watcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}